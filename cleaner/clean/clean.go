@@ -3,9 +3,15 @@ package clean
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
 type IncompleteMetadata struct {
@@ -13,31 +19,38 @@ type IncompleteMetadata struct {
 	CreatedAt time.Time
 }
 
-func CleanWhatWasLeftBehind(ctx context.Context) error {
-	fmt.Println("Cleaning...")
+var tracer = otel.Tracer("github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/cleaner/clean")
 
-	err := InitializeMongoClient(ctx)
-	if err != nil {
-		return fmt.Errorf("Error initializing MongoDB client: %w", err)
-	}
-	defer DisconnectMongoClient()
+// CleanWhatWasLeftBehind removes the uploads that did not complete within the configured age, their metadata and their bytes.
+func CleanWhatWasLeftBehind(ctx context.Context, cfg Config, collection FileMetadata, store storage.BlobStore) (err error) {
+	ctx, span := tracer.Start(ctx, "CleanWhatWasLeftBehind")
+	defer func() { tracing.End(span, err) }()
 
-	files, err := FetchIncompleteMetadata(ctx)
+	slog.Info("Cleaning")
+
+	files, err := FetchIncompleteMetadata(ctx, collection, cfg.OlderThan, cfg.Limit)
 	if err != nil {
 		return fmt.Errorf("Error fetching incomplete metadata: %w", err)
 	}
 
+	cleaned := 0
 	for _, file := range files {
-		err := CleanFileBytes(file)
+		// the metadata is deleted first, a PATCH or a completion after the fetch keeps the upload and its bytes
+		deleted, err := CleanFileMetadata(ctx, collection, file, cfg.OlderThan)
 		if err != nil {
-			return fmt.Errorf("Error cleaning file bytes for FileId %s: %w", file.FileId.String(), err)
+			return fmt.Errorf("Error deleting incomplete metadata for FileId %s: %w", file.FileId.String(), err)
+		}
+		if !deleted {
+			continue
 		}
-		err = CleanFileMetadata(ctx, file)
+		err = CleanFileBytes(ctx, store, file)
 		if err != nil {
-			return fmt.Errorf("Error deleting incomplete metadata for FileId %s: %w", file.FileId.String(), err)
+			return fmt.Errorf("Error cleaning file bytes for FileId %s: %w", file.FileId.String(), err)
 		}
+		cleaned++
 	}
 
-	fmt.Println("Cleaned")
+	span.SetAttributes(attribute.Int("files.cleaned", cleaned))
+	slog.Info("Cleaned", "count", cleaned, "kept", len(files)-cleaned)
 	return nil
 }
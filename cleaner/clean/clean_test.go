@@ -0,0 +1,99 @@
+package clean
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+// fakeFileMetadata returns the uploads as stale and deletes all of them except those that continued after they were fetched.
+type fakeFileMetadata struct {
+	uploads   []uuid.UUID
+	continued map[uuid.UUID]bool
+	deleted   []uuid.UUID
+}
+
+func (f *fakeFileMetadata) Find(ctx context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	documents := make([]any, 0, len(f.uploads))
+	for _, fileId := range f.uploads {
+		documents = append(documents, bson.M{
+			"FileId":    primitive.Binary{Subtype: 4, Data: fileId[:]},
+			"CreatedAt": time.Now().Add(-48 * time.Hour),
+		})
+	}
+	return mongo.NewCursorFromDocuments(documents, nil, nil)
+}
+
+func (f *fakeFileMetadata) DeleteOne(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	fileId := uuid.UUID(filter.(bson.M)["FileId"].(primitive.Binary).Data)
+	if f.continued[fileId] {
+		// the staleness condition of the filter no longer matches
+		return &mongo.DeleteResult{DeletedCount: 0}, nil
+	}
+
+	f.deleted = append(f.deleted, fileId)
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+// An upload that received a chunk after it was fetched keeps its metadata and its bytes.
+func TestCleanWhatWasLeftBehindKeepsUploadThatContinued(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+	stale, continued := uuid.New(), uuid.New()
+	storeBlob(t, store, stale.String()+"/chunks/00000000000000000000-a")
+	storeBlob(t, store, continued.String()+"/chunks/00000000000000000000-b")
+	collection := &fakeFileMetadata{uploads: []uuid.UUID{stale, continued}, continued: map[uuid.UUID]bool{continued: true}}
+
+	if err := CleanWhatWasLeftBehind(ctx, DefaultConfig(), collection, store); err != nil {
+		t.Fatalf("CleanWhatWasLeftBehind failed: %v", err)
+	}
+
+	if len(collection.deleted) != 1 || collection.deleted[0] != stale {
+		t.Fatalf("deleted the metadata of %v, want only %s", collection.deleted, stale)
+	}
+	if blobs := listBlobs(t, store, stale); len(blobs) != 0 {
+		t.Fatalf("the stale upload kept the blobs %v, want none", blobs)
+	}
+	if blobs := listBlobs(t, store, continued); len(blobs) != 1 {
+		t.Fatalf("the upload that continued has the blobs %v, want its chunk", blobs)
+	}
+}
+
+func storeBlob(t *testing.T, store storage.BlobStore, name string) {
+	t.Helper()
+
+	writer, err := store.Create(context.Background(), name)
+	if err != nil {
+		t.Fatalf("failed to create blob: %v", err)
+	}
+	if _, err := writer.Write([]byte("chunk")); err != nil {
+		t.Fatalf("failed to write blob: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close blob: %v", err)
+	}
+}
+
+func listBlobs(t *testing.T, store storage.BlobStore, fileId uuid.UUID) []string {
+	t.Helper()
+
+	blobs, err := store.List(context.Background(), fileId.String()+"/")
+	if err != nil {
+		t.Fatalf("failed to list blobs: %v", err)
+	}
+
+	names := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		names = append(names, strings.TrimPrefix(blob.Name, fileId.String()+"/"))
+	}
+	return names
+}
@@ -0,0 +1,47 @@
+package clean
+
+import (
+	"errors"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// Config of the cleaner, loaded with the shared config package.
+type Config struct {
+	Logging   config.Logging `yaml:"logging"`
+	Tracing   config.Tracing `yaml:"tracing"`
+	MongoDB   config.MongoDB `yaml:"mongodb"`
+	Storage   config.Storage `yaml:"storage"`
+	OlderThan time.Duration  `yaml:"olderThan" env:"CLEANER_OLDER_THAN" flag:"older-than" usage:"minimum age of an incomplete upload before it is cleaned"`
+	Limit     int64          `yaml:"limit" env:"CLEANER_LIMIT" flag:"limit" usage:"maximum number of incomplete uploads cleaned in one run"`
+	// the cleaner runs as a job, the endpoints are only available while it cleans
+	StatusAddress string        `yaml:"statusAddress" env:"CLEANER_STATUS_ADDRESS" flag:"status-address" usage:"address of the health endpoints"`
+	Health        config.Health `yaml:"health"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Logging:       config.DefaultLogging(),
+		Tracing:       config.DefaultTracing(),
+		MongoDB:       config.DefaultMongoDB(),
+		Storage:       config.DefaultStorage("../producer/storage"),
+		OlderThan:     time.Hour,
+		Limit:         1000,
+		StatusAddress: ":8084",
+		Health:        config.DefaultHealth(),
+	}
+}
+
+func (c *Config) Validate() error {
+	return errors.Join(
+		c.MongoDB.Validate(),
+		c.Storage.Validate(),
+		// a younger upload might still be in progress
+		config.Positive("older than", c.OlderThan),
+		config.Positive("limit", c.Limit),
+		c.Health.Validate(),
+		c.Logging.Validate(),
+		c.Tracing.Validate(),
+	)
+}
@@ -3,6 +3,7 @@ package clean
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,25 +11,44 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-)
 
-var (
-	client    *mongo.Client
-	OlderThan time.Duration = time.Hour
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
 )
 
-const Limit int64 = 1000
+// FileMetadata are the operations of the cleaner on the collection of the file metadata, *mongo.Collection implements them.
+// Tests pass a fake.
+type FileMetadata interface {
+	Find(ctx context.Context, filter any, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	DeleteOne(ctx context.Context, filter any, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+}
 
-func FetchIncompleteMetadata(ctx context.Context) ([]IncompleteMetadata, error) {
-	collection := client.Database("store_file").Collection("file")
+var _ FileMetadata = (*mongo.Collection)(nil)
 
-	cutoff := time.Now().UTC().Add(-OlderThan)
-	filter := map[string]any{
-		"StoredAt":  map[string]any{"$exists": false},
-		"CreatedAt": map[string]any{"$lt": cutoff},
+// FileCollection returns the collection of the file metadata.
+func FileCollection(db mongodb.Connection) *mongo.Collection {
+	return db.Database("store_file").Collection("file")
+}
+
+// staleUploadFilter matches the uploads that did not complete within olderThan.
+// A resumable upload is only stale if it did not receive a chunk for a while.
+func staleUploadFilter(olderThan time.Duration) bson.M {
+	cutoff := time.Now().UTC().Add(-olderThan)
+	return bson.M{
+		"StoredAt":  bson.M{"$exists": false},
+		"CreatedAt": bson.M{"$lt": cutoff},
+		"$or": bson.A{
+			bson.M{"Upload.LastChunkAt": bson.M{"$exists": false}},
+			bson.M{"Upload.LastChunkAt": bson.M{"$lt": cutoff}},
+		},
 	}
+}
 
-	findOpts := options.Find().SetLimit(Limit)
+// FetchIncompleteMetadata returns at most limit uploads that did not complete within olderThan.
+func FetchIncompleteMetadata(ctx context.Context, collection FileMetadata, olderThan time.Duration, limit int64) ([]IncompleteMetadata, error) {
+	filter := staleUploadFilter(olderThan)
+
+	findOpts := options.Find().SetLimit(limit)
 	cursor, err := collection.Find(ctx, filter, findOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query incomplete metadata: %w", err)
@@ -52,25 +72,30 @@ func FetchIncompleteMetadata(ctx context.Context) ([]IncompleteMetadata, error)
 		return nil, fmt.Errorf("cursor error: %w", err)
 	}
 
-	fmt.Printf("Found %d incomplete metadata entries older than %s\n", len(results), OlderThan)
+	slog.Info("Found incomplete metadata", "count", len(results), "older_than", olderThan)
 	for _, entry := range results {
-		fmt.Printf("FileId: %s, CreatedAt: %s (UTC)\n", entry.FileId, entry.CreatedAt.UTC().Format(time.RFC3339))
+		slog.Debug("Incomplete metadata", logging.KeyFileId, entry.FileId, "created_at", entry.CreatedAt.UTC())
 	}
 	return results, nil
 }
 
-func CleanFileMetadata(ctx context.Context, file IncompleteMetadata) error {
-	collection := client.Database("store_file").Collection("file")
-
-	filter := bson.M{"FileId": primitive.Binary{Subtype: 4, Data: file.FileId[:]}}
+// CleanFileMetadata deletes the metadata of the upload if it is still stale and returns whether it was deleted.
+// The upload can receive a chunk or complete after it was fetched, then its metadata and its bytes are kept.
+func CleanFileMetadata(ctx context.Context, collection FileMetadata, file IncompleteMetadata, olderThan time.Duration) (bool, error) {
+	filter := staleUploadFilter(olderThan)
+	filter["FileId"] = primitive.Binary{Subtype: 4, Data: file.FileId[:]}
 
-	_, err := collection.DeleteOne(ctx, filter)
+	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return fmt.Errorf("failed to delete incomplete metadata for FileId %s: %w", file.FileId.String(), err)
+		return false, fmt.Errorf("failed to delete incomplete metadata for FileId %s: %w", file.FileId.String(), err)
+	}
+	if result.DeletedCount != 1 {
+		slog.Info("Kept metadata of an upload that continued or completed", logging.KeyFileId, file.FileId)
+		return false, nil
 	}
 
-	fmt.Printf("Deleted incomplete metadata for FileId %s\n", file.FileId.String())
-	return nil
+	slog.Info("Deleted incomplete metadata", logging.KeyFileId, file.FileId)
+	return true, nil
 }
 
 func UnmarshalBSON(data []byte) (IncompleteMetadata, error) {
@@ -94,36 +119,3 @@ func UnmarshalBSON(data []byte) (IncompleteMetadata, error) {
 		CreatedAt: createdAt,
 	}, nil
 }
-
-func InitializeMongoClient(ctx context.Context) error {
-	if client == nil {
-		var err error
-		clientOptions := options.Client().
-			ApplyURI("mongodb://localhost:27017/?replicaSet=rs0")
-		client, err = mongo.Connect(ctx, clientOptions)
-		if err != nil {
-			return fmt.Errorf("failed to connect to MongoDB: %v", err)
-		}
-		fmt.Println("MongoDB client initialized")
-
-		if err := client.Ping(ctx, nil); err != nil {
-			return fmt.Errorf("failed to ping MongoDB: %v", err)
-		}
-		fmt.Println("MongoDB ping successful")
-	}
-	return nil
-}
-
-func DisconnectMongoClient() {
-	if client != nil {
-		// Create a new context with timeout for disconnect operation, the application context might be cancelled
-		disconnectCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := client.Disconnect(disconnectCtx); err != nil {
-			fmt.Printf("Failed to disconnect MongoDB client: %v\n", err)
-		} else {
-			fmt.Println("MongoDB client disconnected")
-		}
-	}
-}
@@ -0,0 +1,56 @@
+package clean
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+// The upload can continue or complete between FetchIncompleteMetadata and CleanFileMetadata, then it must be kept.
+func TestCleanFileMetadataDeletesOnlyStaleUploads(t *testing.T) {
+	ctx := context.Background()
+	collection := FileCollection(mongodbtest.Connect(t))
+	now := time.Now().UTC()
+	olderThan := time.Hour
+	createdAt := now.Add(-2 * olderThan)
+
+	tests := []struct {
+		name     string
+		document bson.M
+		want     bool
+	}{
+		{name: "stale upload", document: bson.M{"CreatedAt": createdAt}, want: true},
+		{name: "stale resumable upload", document: bson.M{"CreatedAt": createdAt, "Upload": bson.M{"LastChunkAt": createdAt}}, want: true},
+		{name: "resumable upload that received a chunk", document: bson.M{"CreatedAt": createdAt, "Upload": bson.M{"LastChunkAt": now}}, want: false},
+		{name: "completed upload", document: bson.M{"CreatedAt": createdAt, "StoredAt": now}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileId := uuid.New()
+			test.document["FileId"] = primitive.Binary{Subtype: 4, Data: fileId[:]}
+			if _, err := collection.InsertOne(ctx, test.document); err != nil {
+				t.Fatalf("failed to insert upload: %v", err)
+			}
+
+			deleted, err := CleanFileMetadata(ctx, collection, IncompleteMetadata{FileId: fileId, CreatedAt: createdAt}, olderThan)
+			if err != nil {
+				t.Fatalf("CleanFileMetadata failed: %v", err)
+			}
+
+			count, err := collection.CountDocuments(ctx, bson.M{"FileId": test.document["FileId"]})
+			if err != nil {
+				t.Fatalf("failed to count uploads: %v", err)
+			}
+			if deleted != test.want || (count == 0) != test.want {
+				t.Fatalf("CleanFileMetadata returned %v and left %d documents, want deleted %v", deleted, count, test.want)
+			}
+		})
+	}
+}
@@ -1,23 +1,27 @@
 package clean
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path"
-)
+	"log/slog"
 
-const (
-	StoragePath = "../producer/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
 )
 
-func CleanFileBytes(file IncompleteMetadata) error {
-	fileFolder := path.Join(StoragePath, file.FileId.String())
-
-	err := os.RemoveAll(fileFolder)
+// CleanFileBytes deletes every blob of the file, the file itself and the chunks of a resumable upload.
+func CleanFileBytes(ctx context.Context, store storage.BlobStore, file IncompleteMetadata) error {
+	blobs, err := store.List(ctx, file.FileId.String()+"/")
 	if err != nil {
-		return fmt.Errorf("failed to remove folder %s: %w", fileFolder, err)
+		return fmt.Errorf("failed to list blobs of FileId %s: %w", file.FileId.String(), err)
+	}
+
+	for _, blob := range blobs {
+		if err := store.Delete(ctx, blob.Name); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Cleaned up file bytes for FileId: %s\n", file.FileId.String())
+	slog.Info("Cleaned up file bytes", logging.KeyFileId, file.FileId, "blobs", len(blobs))
 	return nil
 }
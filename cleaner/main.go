@@ -2,24 +2,88 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/cleaner/clean"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/health"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
 func main() {
-	fmt.Println("Starting cleaner...")
+	cfg := clean.DefaultConfig()
+	if err := config.Load("cleaner", os.Args[1:], &cfg); err != nil {
+		slog.Error("Error loading configuration", logging.Error(err))
+		os.Exit(2)
+	}
+	if err := logging.Setup("cleaner", cfg.Logging); err != nil {
+		slog.Error("Error setting up logging", logging.Error(err))
+		os.Exit(2)
+	}
+
+	slog.Info("Starting cleaner")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
-	err := clean.CleanWhatWasLeftBehind(ctx)
+	shutdownTracing, err := tracing.Setup(ctx, "cleaner", cfg.Tracing)
+	if err != nil {
+		slog.Error("Error setting up tracing", logging.Error(err))
+		return
+	}
+	defer shutdownTracing()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
 	if err != nil {
-		fmt.Printf("Error during cleaning: %v\n", err)
+		slog.Error("Error connecting to MongoDB", logging.Error(err))
+		return
 	}
+	defer db.Disconnect()
+
+	store, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		slog.Error("Error creating storage", logging.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := serveHealth(ctx, cfg, db, store)
+		if err != nil {
+			slog.Error("Error serving health", logging.Error(err))
+		}
+	}()
+
+	err = clean.CleanWhatWasLeftBehind(ctx, cfg, clean.FileCollection(db), store)
+	if err != nil {
+		slog.Error("Error during cleaning", logging.Error(err))
+	}
+
+	// the job is done, stop the health endpoints
+	cancel()
+	wg.Wait()
+
+	slog.Info("Shutting down cleaner")
+}
+
+func serveHealth(ctx context.Context, cfg clean.Config, db mongodb.Connection, store storage.BlobStore) error {
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.AddReadinessCheck("mongodb", db.HealthCheck)
+	checker.AddReadinessCheck("storage", store.HealthCheck)
+
+	mux := http.NewServeMux()
+	checker.Register(mux)
 
-	fmt.Println("Shutting down cleaner...")
+	return health.Serve(ctx, cfg.StatusAddress, mux)
 }
@@ -0,0 +1,134 @@
+// deadletter lists the events the consumer failed on after the last retry and replays them onto the topic of the file events.
+//
+// Usage:
+//
+//	deadletter list [configuration flags]
+//	deadletter replay -entry <partition>/<offset> [configuration flags]
+//	deadletter replay -all [configuration flags]
+//
+// The configuration of the consumer is loaded like for the consumer itself.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(ctx, loadConfiguration(flag.NewFlagSet("list", flag.ExitOnError), os.Args[2:]))
+	case "replay":
+		replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+		entry := replayFlags.String("entry", "", "dead letter to replay as <partition>/<offset>")
+		all := replayFlags.Bool("all", false, "replay all dead letters")
+		err = replay(ctx, loadConfiguration(replayFlags, os.Args[2:]), *entry, *all)
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadConfiguration parses the flags of the subcommand together with the configuration flags.
+func loadConfiguration(flags *flag.FlagSet, args []string) metadata.Config {
+	cfg := metadata.DefaultConfig()
+	if err := config.LoadWithFlags(flags, args, &cfg); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup("deadletter", cfg.Logging); err != nil {
+		fmt.Printf("Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+
+	return cfg
+}
+
+func printUsage() {
+	fmt.Println("Usage: deadletter list | deadletter replay (-entry <partition>/<offset> | -all)")
+}
+
+func list(ctx context.Context, cfg metadata.Config) error {
+	deadLetters, err := metadata.ReadDeadLetters(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, deadLetter := range deadLetters {
+		fmt.Printf("%s (file %s, originally %s) failed at %s after %s attempts: %s\n",
+			entryOf(deadLetter), deadLetter.Key, deadLetter.Original, deadLetter.FailedAt, deadLetter.Attempts, deadLetter.Reason)
+	}
+	fmt.Printf("%d dead letters in %s\n", len(deadLetters), cfg.Retry.DeadLetterTopic)
+
+	return nil
+}
+
+func replay(ctx context.Context, cfg metadata.Config, entry string, all bool) error {
+	if entry == "" && !all {
+		return fmt.Errorf("either -entry or -all is required")
+	}
+
+	deadLetters, err := metadata.ReadDeadLetters(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	retrier, err := metadata.NewRetrier(cfg)
+	if err != nil {
+		return err
+	}
+	defer retrier.Close()
+
+	replayed, failed := 0, 0
+	for _, deadLetter := range deadLetters {
+		if !all && entryOf(deadLetter) != entry {
+			continue
+		}
+
+		if err := retrier.ReplayDeadLetter(deadLetter); err != nil {
+			failed++
+			fmt.Printf("Failed to replay %s: %v\n", entryOf(deadLetter), err)
+			continue
+		}
+		replayed++
+		fmt.Printf("Replayed %s\n", entryOf(deadLetter))
+	}
+
+	if replayed == 0 && failed == 0 {
+		if all {
+			return nil
+		}
+		return fmt.Errorf("dead letter %s not found", entry)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d dead letters could not be replayed", failed, failed+replayed)
+	}
+
+	return nil
+}
+
+func entryOf(deadLetter metadata.DeadLetter) string {
+	return fmt.Sprintf("%d/%d", deadLetter.Partition, deadLetter.Offset)
+}
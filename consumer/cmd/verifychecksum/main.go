@@ -0,0 +1,100 @@
+// verifychecksum downloads the files of the read model from the producer and compares their content with the checksum
+// of their FileStored event. It exits with 1 if the content of a file differs or a file cannot be downloaded.
+//
+// Usage:
+//
+//	verifychecksum [-producer-url <url>] [-file <file id>] [configuration flags]
+//
+// The configuration of the consumer is loaded like for the consumer itself.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	verifyFlags := flag.NewFlagSet("verifychecksum", flag.ExitOnError)
+	producerURL := verifyFlags.String("producer-url", "http://localhost:8082", "base URL of the file API of the producer")
+	fileId := verifyFlags.String("file", "", "verify only this file instead of all files of the read model")
+
+	cfg := metadata.DefaultConfig()
+	if err := config.LoadWithFlags(verifyFlags, os.Args[1:], &cfg); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup("verifychecksum", cfg.Logging); err != nil {
+		fmt.Printf("Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		fmt.Printf("Error connecting to MongoDB: %v\n", err)
+		os.Exit(2)
+	}
+	defer db.Disconnect()
+
+	files, err := fetchProjectedFiles(ctx, db, *fileId)
+	if err != nil {
+		fmt.Printf("Error reading read model: %v\n", err)
+		os.Exit(2)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	verified, missing, failed := 0, 0, 0
+	for _, file := range files {
+		err := metadata.VerifyDownload(ctx, client, *producerURL, file.FileId, file.Checksum.Event())
+		switch {
+		case err == nil:
+			verified++
+		case errors.Is(err, metadata.ErrChecksumMissing):
+			missing++
+			fmt.Printf("Unverified: %s was stored without checksum\n", file.FileId)
+		default:
+			failed++
+			fmt.Printf("Failed: %s: %v\n", file.FileId, err)
+		}
+	}
+
+	fmt.Printf("Files: %d, verified: %d, without checksum: %d, failed: %d\n", len(files), verified, missing, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func fetchProjectedFiles(ctx context.Context, db mongodb.Connection, fileId string) ([]readmodel.File, error) {
+	filter := bson.M{"DeletedAt": bson.M{"$exists": false}}
+	if fileId != "" {
+		filter["_id"] = fileId
+	}
+
+	cursor, err := readmodel.FileCollection(db).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read model: %w", err)
+	}
+
+	var files []readmodel.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode read model: %w", err)
+	}
+
+	return files, nil
+}
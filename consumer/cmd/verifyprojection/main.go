@@ -0,0 +1,154 @@
+// verifyprojection compares the read model of the consumer with the completed files in MongoDB and checks with the inbox
+// that no FileStored event was applied again after it was processed. It exits with 1 if the read model is wrong.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/inbox"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/google/uuid"
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var fileStoredEventType = string((&api.FileStored{}).ProtoReflect().Descriptor().FullName())
+
+type storedFile struct {
+	Size      int64  `bson:"Size"`
+	MediaType string `bson:"MediaType"`
+}
+
+func main() {
+	cfg := metadata.DefaultConfig()
+	if err := config.Load("verifyprojection", os.Args[1:], &cfg); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup("verifyprojection", cfg.Logging); err != nil {
+		fmt.Printf("Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		fmt.Printf("Error connecting to MongoDB: %v\n", err)
+		os.Exit(2)
+	}
+	defer db.Disconnect()
+
+	stored, err := fetchStoredFiles(ctx, db)
+	if err != nil {
+		fmt.Printf("Error reading stored files: %v\n", err)
+		os.Exit(2)
+	}
+
+	projected, err := fetchProjectedFiles(ctx, db)
+	if err != nil {
+		fmt.Printf("Error reading read model: %v\n", err)
+		os.Exit(2)
+	}
+
+	entries, err := inbox.FetchEntries(ctx, inbox.Collection(db))
+	if err != nil {
+		fmt.Printf("Error reading inbox: %v\n", err)
+		os.Exit(2)
+	}
+
+	mismatches := 0
+	for fileId, file := range stored {
+		projectedFile, ok := projected[fileId]
+		switch {
+		case !ok:
+			mismatches++
+			fmt.Printf("Missing: %s was stored but is not in the read model\n", fileId)
+		case projectedFile.Size != file.Size || projectedFile.MediaType != file.MediaType:
+			mismatches++
+			fmt.Printf("Different: %s is stored with %d bytes of %s but projected with %d bytes of %s\n",
+				fileId, file.Size, file.MediaType, projectedFile.Size, projectedFile.MediaType)
+		}
+	}
+	for fileId := range projected {
+		if _, ok := stored[fileId]; !ok {
+			mismatches++
+			fmt.Printf("Unknown: %s is in the read model but was never stored\n", fileId)
+		}
+	}
+
+	reapplied, duplicates := 0, int64(0)
+	for _, entry := range entries {
+		duplicates += entry.Duplicates
+		if entry.EventType != fileStoredEventType {
+			continue
+		}
+		// the file is projected in the transaction that records the entry, a later projection means a duplicate was applied
+		if projectedFile, ok := projected[entry.FileId]; ok && projectedFile.ProjectedAt.After(entry.ProcessedAt) {
+			reapplied++
+			fmt.Printf("Reapplied: %s was projected again after its FileStored was processed\n", entry.FileId)
+		}
+	}
+
+	fmt.Printf("Stored files: %d, projected files: %d, processed events: %d, skipped duplicates: %d, mismatches: %d, reapplied: %d\n",
+		len(stored), len(projected), len(entries), duplicates, mismatches, reapplied)
+	if mismatches > 0 || reapplied > 0 {
+		os.Exit(1)
+	}
+}
+
+func fetchStoredFiles(ctx context.Context, db mongodb.Connection) (map[string]storedFile, error) {
+	collection := db.Database("store_file").Collection("file")
+	cursor, err := collection.Find(ctx, bson.M{"StoredAt": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored files: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	files := make(map[string]storedFile)
+	for cursor.Next(ctx) {
+		_, fileIdData, ok := cursor.Current.Lookup("FileId").BinaryOK()
+		if !ok {
+			return nil, fmt.Errorf("FileId missing or not binary")
+		}
+		fileId, err := uuid.FromBytes(fileIdData)
+		if err != nil {
+			return nil, fmt.Errorf("FileId bytes could not be parsed as UUID: %w", err)
+		}
+
+		var file storedFile
+		if err := cursor.Decode(&file); err != nil {
+			return nil, fmt.Errorf("failed to decode stored file %s: %w", fileId, err)
+		}
+		files[fileId.String()] = file
+	}
+
+	return files, cursor.Err()
+}
+
+func fetchProjectedFiles(ctx context.Context, db mongodb.Connection) (map[string]readmodel.File, error) {
+	cursor, err := readmodel.FileCollection(db).Find(ctx, bson.M{"DeletedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read model: %w", err)
+	}
+
+	var files []readmodel.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode read model: %w", err)
+	}
+
+	projected := make(map[string]readmodel.File, len(files))
+	for _, file := range files {
+		projected[file.FileId] = file
+	}
+
+	return projected, nil
+}
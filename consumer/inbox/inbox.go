@@ -0,0 +1,156 @@
+// Package inbox records the events a consumer has processed, so that an event that is delivered again is skipped.
+//
+// The miner publishes at least once and the snapshot publishes stored files again, so the same event can arrive several times.
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+)
+
+// Key identifies an event independent of how often it was published.
+type Key struct {
+	FileId    string
+	EventType string
+	// Version tells apart several events of the same type of a file, e.g. the time of the change
+	Version string
+}
+
+func (k Key) String() string {
+	return k.FileId + "/" + k.EventType + "/" + k.Version
+}
+
+// Keyed is implemented by the events of the handlers, each event declares the key it is processed once under.
+type Keyed interface {
+	IdempotencyKey() Key
+}
+
+// Entry is a processed event. It is removed by MongoDB after ExpiresAt, an event delivered again after that is processed again.
+type Entry struct {
+	Id          string    `bson:"_id"`
+	FileId      string    `bson:"FileId"`
+	EventType   string    `bson:"EventType"`
+	Version     string    `bson:"Version"`
+	ProcessedAt time.Time `bson:"ProcessedAt"`
+	ExpiresAt   time.Time `bson:"ExpiresAt"`
+	// Duplicates counts the deliveries that were skipped
+	Duplicates int64 `bson:"Duplicates"`
+}
+
+// Inbox processes each key once within the retention.
+type Inbox struct {
+	collection *mongo.Collection
+	retention  time.Duration
+}
+
+// Collection returns the collection of the inbox, it must be in the same replica set as the collections the handlers change.
+func Collection(db mongodb.Connection) *mongo.Collection {
+	return db.Database("consumer").Collection("inbox")
+}
+
+func New(collection *mongo.Collection, retention time.Duration) *Inbox {
+	return &Inbox{
+		collection: collection,
+		retention:  retention,
+	}
+}
+
+// EnsureIndex removes entries that are older than the retention.
+func (i *Inbox) EnsureIndex(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "ExpiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := i.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create inbox index: %w", err)
+	}
+
+	return nil
+}
+
+// Process calls handle unless the key was already processed and returns whether handle was called.
+// The entry is written in the same transaction as the changes of handle, so handle must use the context it is called with.
+// A failed handle leaves no entry behind, so the event is processed again when it is delivered again.
+func (i *Inbox) Process(ctx context.Context, key Key, handle func(ctx context.Context) error) (bool, error) {
+	session, err := i.collection.Database().Client().StartSession()
+	if err != nil {
+		return false, fmt.Errorf("failed to start inbox session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	processed := false
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		processed = false
+
+		duplicate, err := i.skipDuplicate(ctx, key)
+		if err != nil || duplicate {
+			return nil, err
+		}
+
+		if err := handle(ctx); err != nil {
+			return nil, err
+		}
+
+		if err := i.record(ctx, key); err != nil {
+			return nil, err
+		}
+		processed = true
+		return nil, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return processed, nil
+}
+
+// skipDuplicate counts the delivery if the key was already processed.
+func (i *Inbox) skipDuplicate(ctx context.Context, key Key) (bool, error) {
+	result, err := i.collection.UpdateByID(ctx, key.String(), bson.M{"$inc": bson.M{"Duplicates": 1}})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up inbox entry: %w", err)
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (i *Inbox) record(ctx context.Context, key Key) error {
+	now := time.Now().UTC()
+	entry := Entry{
+		Id:          key.String(),
+		FileId:      key.FileId,
+		EventType:   key.EventType,
+		Version:     key.Version,
+		ProcessedAt: now,
+		ExpiresAt:   now.Add(i.retention),
+	}
+
+	if _, err := i.collection.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record inbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// FetchEntries returns all entries of the inbox, ordered by their key.
+func FetchEntries(ctx context.Context, collection *mongo.Collection) ([]Entry, error) {
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inbox: %w", err)
+	}
+
+	entries := []Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode inbox entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,89 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+var testKey = Key{FileId: "4b4f6c3e-3b1a-4c8e-9f3a-2f1d0c9b8a7e", EventType: "FileStored", Version: "2024-01-01T00:00:00Z"}
+
+func TestProcessSkipsProcessedKey(t *testing.T) {
+	ctx := context.Background()
+	collection := Collection(mongodbtest.Connect(t))
+	box := New(collection, time.Hour)
+	handled := 0
+	handle := func(ctx context.Context) error {
+		handled++
+		return nil
+	}
+
+	first, err := box.Process(ctx, testKey, handle)
+	if err != nil {
+		t.Fatalf("first Process failed: %v", err)
+	}
+	second, err := box.Process(ctx, testKey, handle)
+	if err != nil {
+		t.Fatalf("second Process failed: %v", err)
+	}
+
+	if !first || second {
+		t.Fatalf("Process returned %v and %v, want true and false", first, second)
+	}
+	if handled != 1 {
+		t.Fatalf("handle was called %d times, want 1", handled)
+	}
+	entries := fetchEntries(t, collection)
+	if len(entries) != 1 || entries[0].Id != testKey.String() || entries[0].Duplicates != 1 {
+		t.Fatalf("inbox contains %+v, want one entry of %s with one duplicate", entries, testKey)
+	}
+}
+
+func TestProcessLeavesNoEntryOfFailedHandle(t *testing.T) {
+	ctx := context.Background()
+	db := mongodbtest.Connect(t)
+	collection := Collection(db)
+	changes := db.Database("consumer").Collection("change")
+	box := New(collection, time.Hour)
+	errHandle := errors.New("handle failed")
+
+	_, err := box.Process(ctx, testKey, func(ctx context.Context) error {
+		if _, err := changes.InsertOne(ctx, bson.M{"_id": testKey.FileId}); err != nil {
+			return err
+		}
+		return errHandle
+	})
+
+	if !errors.Is(err, errHandle) {
+		t.Fatalf("Process returned %v, want the error of handle", err)
+	}
+	if entries := fetchEntries(t, collection); len(entries) != 0 {
+		t.Fatalf("inbox contains %+v, want no entry", entries)
+	}
+	// the changes of handle are rolled back together with the entry
+	if count, err := changes.CountDocuments(ctx, bson.M{}); err != nil || count != 0 {
+		t.Fatalf("handle left %d changes (%v), want none", count, err)
+	}
+
+	processed, err := box.Process(ctx, testKey, func(ctx context.Context) error { return nil })
+	if err != nil || !processed {
+		t.Fatalf("Process of the delivery after the failure returned %v, %v, want the event to be processed", processed, err)
+	}
+}
+
+func fetchEntries(t *testing.T, collection *mongo.Collection) []Entry {
+	t.Helper()
+
+	entries, err := FetchEntries(context.Background(), collection)
+	if err != nil {
+		t.Fatalf("FetchEntries failed: %v", err)
+	}
+
+	return entries
+}
@@ -2,33 +2,87 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
 	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/health"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
 func main() {
-	fmt.Println("Starting consumer...")
+	cfg := metadata.DefaultConfig()
+	if err := config.Load("consumer", os.Args[1:], &cfg); err != nil {
+		slog.Error("Error loading configuration", logging.Error(err))
+		os.Exit(2)
+	}
+	if err := logging.Setup("consumer", cfg.Logging); err != nil {
+		slog.Error("Error setting up logging", logging.Error(err))
+		os.Exit(2)
+	}
+
+	slog.Info("Starting consumer")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, "consumer", cfg.Tracing)
+	if err != nil {
+		slog.Error("Error setting up tracing", logging.Error(err))
+		return
+	}
+	defer shutdownTracing()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		slog.Error("Error connecting to MongoDB", logging.Error(err))
+		return
+	}
+	defer db.Disconnect()
+
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := metadata.ConsumingFileStored(ctx)
+		err := metadata.ConsumingFileStored(ctx, cfg, db)
 		if err != nil && !os.IsTimeout(err) && err != context.Canceled && err != context.DeadlineExceeded {
-			fmt.Printf("Error consuming file metadata: %v\n", err)
+			slog.Error("Error consuming file metadata", logging.Error(err))
+		}
+		cancel()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := serveHTTP(ctx, cfg, db)
+		if err != nil {
+			slog.Error("Error serving http", logging.Error(err))
 		}
 	}()
 
 	wg.Wait()
 
-	fmt.Println("Shutting down consumer...")
+	slog.Info("Shutting down consumer")
+}
+
+// serveHTTP serves the health endpoints and the query API of the read model.
+func serveHTTP(ctx context.Context, cfg metadata.Config, db mongodb.Connection) error {
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.AddReadinessCheck("kafka", health.KafkaCheck(cfg.Kafka.Brokers))
+	checker.AddReadinessCheck("mongodb", db.HealthCheck)
+
+	mux := http.NewServeMux()
+	checker.Register(mux)
+	readmodel.RegisterQueryAPI(mux, db)
+
+	return health.Serve(ctx, cfg.StatusAddress, mux)
 }
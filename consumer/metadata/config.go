@@ -0,0 +1,76 @@
+package metadata
+
+import (
+	"errors"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// Config of the consumer, loaded with the shared config package.
+type Config struct {
+	Logging       config.Logging `yaml:"logging"`
+	Tracing       config.Tracing `yaml:"tracing"`
+	MongoDB       config.MongoDB `yaml:"mongodb"`
+	Kafka         config.Kafka   `yaml:"kafka"`
+	GroupID       string         `yaml:"groupId" env:"CONSUMER_GROUP_ID" flag:"group-id" usage:"consumer group of the file events"`
+	StatusAddress string         `yaml:"statusAddress" env:"CONSUMER_STATUS_ADDRESS" flag:"status-address" usage:"address of the health endpoints and the query API"`
+	Health        config.Health  `yaml:"health"`
+	Inbox         InboxConfig    `yaml:"inbox"`
+	Retry         RetryConfig    `yaml:"retry"`
+}
+
+type InboxConfig struct {
+	Retention time.Duration `yaml:"retention" env:"CONSUMER_INBOX_RETENTION" flag:"inbox-retention" usage:"how long a processed event is remembered to skip it when it is delivered again"`
+}
+
+type RetryConfig struct {
+	Delays          []time.Duration `yaml:"delays" env:"CONSUMER_RETRY_DELAYS" flag:"retry-delays" usage:"waits before the retries of a failed event, each retry has its own topic <topic>.retry.<delay>"`
+	DeadLetterTopic string          `yaml:"deadLetterTopic" env:"CONSUMER_DEAD_LETTER_TOPIC" flag:"dead-letter-topic" usage:"topic of the events that failed on the last retry"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Logging:       config.DefaultLogging(),
+		Tracing:       config.DefaultTracing(),
+		MongoDB:       config.DefaultMongoDB(),
+		Kafka:         config.DefaultKafka(),
+		GroupID:       "file-stored-group",
+		StatusAddress: ":8083",
+		Health:        config.DefaultHealth(),
+		Inbox: InboxConfig{
+			Retention: 7 * 24 * time.Hour,
+		},
+		Retry: RetryConfig{
+			Delays:          []time.Duration{time.Minute, 10 * time.Minute},
+			DeadLetterTopic: "file-stored.dlt",
+		},
+	}
+}
+
+func (c *Config) Validate() error {
+	errs := []error{
+		c.MongoDB.Validate(),
+		c.Kafka.Validate(),
+		c.Health.Validate(),
+		c.Logging.Validate(),
+		c.Tracing.Validate(),
+		config.Positive("inbox retention", c.Inbox.Retention),
+	}
+
+	if c.GroupID == "" {
+		errs = append(errs, errors.New("consumer group id is required"))
+	}
+	if c.Retry.DeadLetterTopic == "" || c.Retry.DeadLetterTopic == c.Kafka.Topic {
+		errs = append(errs, errors.New("dead letter topic is required and must differ from the topic of the file events"))
+	}
+	for i, delay := range c.Retry.Delays {
+		if delay < time.Second || (i > 0 && delay <= c.Retry.Delays[i-1]) {
+			// each delay names its own retry topic
+			errs = append(errs, errors.New("retry delays must be at least a second and increase"))
+			break
+		}
+	}
+
+	return errors.Join(errs...)
+}
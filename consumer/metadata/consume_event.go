@@ -3,52 +3,126 @@ package metadata
 import (
 	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/inbox"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	brokers       = []string{"localhost:9095"}
-	topic         = "file-stored"
-	groupID       = "file-stored-group"
-	consumerGroup sarama.ConsumerGroup
-)
+var tracer = otel.Tracer("github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/metadata")
 
-type fileStoredHandler struct{}
+type fileStoredHandler struct {
+	files   *mongo.Collection
+	inbox   *inbox.Inbox
+	retrier *Retrier
+	groupID string
+}
 
 func (h *fileStoredHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
 func (h *fileStoredHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim handles the messages of one partition one after another.
+// A failed message is forwarded to the next retry topic and only marked afterwards, a message of a retry topic is handled when it is due.
+// The miner keys the events by file id, but a retried event is handled after the later events of its file.
+// The read model tolerates that, see readmodel.ProjectFileStored.
 func (h *fileStoredHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for message := range claim.Messages() {
-		if err := DecodeMessage(message); err != nil {
-			fmt.Printf("Error decoding message: %v\n", err)
+		if !waitForRetry(sess.Context(), message) {
+			return nil
+		}
+
+		ctx, span := startProcessSpan(sess.Context(), message, h.groupID)
+		err := HandleMessage(ctx, h.inbox, h.files, message)
+		tracing.End(span, err)
+		if err != nil {
+			if sess.Context().Err() != nil {
+				// the rebalance cancelled the message, it is delivered again
+				return nil
+			}
+			messageLogger(message).Error("Error handling message", logging.Error(err))
+			if !h.retrier.forwardFailedMessage(sess.Context(), message, err) {
+				return nil
+			}
 		}
 		sess.MarkMessage(message, "")
 	}
 	return nil
 }
 
-func ConsumingFileStored(ctx context.Context) error {
+// startProcessSpan continues the trace of the producer and the miner from the record headers.
+func startProcessSpan(ctx context.Context, message *sarama.ConsumerMessage, groupID string) (context.Context, trace.Span) {
+	ctx = tracing.ExtractMessage(ctx, message)
+	return tracer.Start(ctx, message.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", message.Topic),
+			attribute.String("messaging.consumer.group.name", groupID),
+			attribute.Int("messaging.destination.partition.id", int(message.Partition)),
+			attribute.Int64("messaging.kafka.offset", message.Offset),
+			attribute.String("file.id", string(message.Key)),
+		))
+}
+
+// messageLogger logs with the position of the message, the message key is the file id.
+func messageLogger(message *sarama.ConsumerMessage) *slog.Logger {
+	return slog.With(
+		logging.KeyTopic, message.Topic,
+		logging.KeyPartition, message.Partition,
+		logging.KeyOffset, message.Offset,
+		logging.KeyFileId, string(message.Key),
+		logging.KeyCorrelationId, HeaderValue(message, HeaderCorrelationId),
+	)
+}
+
+// ConsumingFileStored projects the file events into the read model of the files.
+func ConsumingFileStored(ctx context.Context, cfg Config, db mongodb.Connection) error {
+	files := readmodel.FileCollection(db)
+	if err := readmodel.EnsureIndexes(ctx, files); err != nil {
+		return err
+	}
+	box := inbox.New(inbox.Collection(db), cfg.Inbox.Retention)
+	if err := box.EnsureIndex(ctx); err != nil {
+		return err
+	}
+
 	config := sarama.NewConfig()
 	config.Consumer.Return.Errors = true
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	// events of aborted transactions of the miner must not be consumed
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
 
-	var err error
-	consumerGroup, err = sarama.NewConsumerGroup(brokers, groupID, config)
+	consumerGroup, err := sarama.NewConsumerGroup(cfg.Kafka.Brokers, cfg.GroupID, config)
 	if err != nil {
 		return fmt.Errorf("failed to create consumer group: %w", err)
 	}
 	defer consumerGroup.Close()
 
-	handler := &fileStoredHandler{}
+	retrier, err := NewRetrier(cfg)
+	if err != nil {
+		return err
+	}
+	defer retrier.Close()
+
+	handler := &fileStoredHandler{files: files, inbox: box, retrier: retrier, groupID: cfg.GroupID}
+	topics := append([]string{cfg.Kafka.Topic}, cfg.RetryTopics()...)
 
-	fmt.Println("Waiting file metadata events...")
+	slog.Info("Waiting for file metadata events", logging.KeyTopic, cfg.Kafka.Topic, "retry_topics", cfg.RetryTopics(), "dead_letter_topic", cfg.Retry.DeadLetterTopic, "group_id", cfg.GroupID)
 	for {
-		if err := consumerGroup.Consume(ctx, []string{topic}, handler); err != nil {
+		if err := consumerGroup.Consume(ctx, topics, handler); err != nil {
 			return fmt.Errorf("error from consumer: %w", err)
 		}
 		if ctx.Err() != nil {
-			fmt.Println("Context cancelled, mining file metadata stopped")
+			slog.Info("Context cancelled, consuming file metadata stopped")
 			return ctx.Err()
 		}
 	}
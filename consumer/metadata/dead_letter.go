@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// DeadLetterReadIdleTimeout ends reading the dead letter topic when no further message arrives
+var DeadLetterReadIdleTimeout = 5 * time.Second
+
+// DeadLetter is a message that failed on the last retry or could not be decoded.
+type DeadLetter struct {
+	Partition int32
+	Offset    int64
+	Reason    string
+	FailedAt  string
+	Attempts  string
+	// Original is the position of the message on the main topic as <topic>/<partition>/<offset>
+	Original string
+	Key      []byte
+	Value    []byte
+	Headers  []sarama.RecordHeader
+}
+
+// ReadDeadLetters returns all dead letters from the beginning of the dead letter topic.
+func ReadDeadLetters(ctx context.Context, cfg Config) ([]DeadLetter, error) {
+	deadLetterTopic := cfg.Retry.DeadLetterTopic
+	consumer, err := sarama.NewConsumer(cfg.Kafka.Brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(deadLetterTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch partitions of topic %s: %w", deadLetterTopic, err)
+	}
+
+	var deadLetters []DeadLetter
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(deadLetterTopic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to consume partition %d of topic %s: %w", partition, deadLetterTopic, err)
+		}
+
+		deadLetters, err = readDeadLetterPartition(ctx, partitionConsumer, deadLetters)
+		partitionConsumer.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deadLetters, nil
+}
+
+func readDeadLetterPartition(ctx context.Context, partitionConsumer sarama.PartitionConsumer, deadLetters []DeadLetter) ([]DeadLetter, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(DeadLetterReadIdleTimeout):
+			return deadLetters, nil
+		case message := <-partitionConsumer.Messages():
+			headers := make([]sarama.RecordHeader, len(message.Headers))
+			for i, header := range message.Headers {
+				headers[i] = *header
+			}
+			deadLetters = append(deadLetters, DeadLetter{
+				Partition: message.Partition,
+				Offset:    message.Offset,
+				Reason:    HeaderValue(message, HeaderErrorReason),
+				FailedAt:  HeaderValue(message, HeaderFailedAt),
+				Attempts:  HeaderValue(message, HeaderAttempts),
+				Original: fmt.Sprintf("%s/%s/%s", HeaderValue(message, HeaderOriginalTopic),
+					HeaderValue(message, HeaderOriginalPartition), HeaderValue(message, HeaderOriginalOffset)),
+				Key:     message.Key,
+				Value:   message.Value,
+				Headers: headers,
+			})
+		}
+	}
+}
+
+// ReplayDeadLetter publishes the dead letter to the main topic with the headers of the original event, e.g. after the handler was fixed.
+// The replayed message starts again with the first attempt and is dead lettered again if it keeps failing.
+func (r *Retrier) ReplayDeadLetter(deadLetter DeadLetter) error {
+	headers := make([]sarama.RecordHeader, 0, len(deadLetter.Headers))
+	for _, header := range deadLetter.Headers {
+		if !failureHeaders[string(header.Key)] && !originalHeaders[string(header.Key)] {
+			headers = append(headers, header)
+		}
+	}
+
+	_, _, err := r.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   r.topic,
+		Key:     sarama.ByteEncoder(deadLetter.Key),
+		Value:   sarama.ByteEncoder(deadLetter.Value),
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter to %s: %w", r.topic, err)
+	}
+
+	return nil
+}
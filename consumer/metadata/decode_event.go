@@ -1,20 +1,158 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/inbox"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
 	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"go.mongodb.org/mongo-driver/mongo"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func DecodeMessage(message *sarama.ConsumerMessage) error {
-	fileStored := &api.FileStored{}
-	err := proto.Unmarshal(message.Value, fileStored)
+// Event is a decoded event. It declares its idempotency key, so that the inbox applies an event that is delivered again only once.
+type Event interface {
+	inbox.Keyed
+	// Apply applies the event to the read model of the files
+	Apply(ctx context.Context, files *mongo.Collection) error
+}
+
+type eventDecoder func(message *sarama.ConsumerMessage) (Event, error)
+
+var (
+	fileStoredEventType  = string((&api.FileStored{}).ProtoReflect().Descriptor().FullName())
+	fileDeletedEventType = string((&api.FileDeleted{}).ProtoReflect().Descriptor().FullName())
+	fileCleanedEventType = string((&api.FileCleaned{}).ProtoReflect().Descriptor().FullName())
+	// eventDecoders maps the event type header to the decoder of the event
+	eventDecoders = map[string]eventDecoder{
+		fileStoredEventType:  decodeFileStored,
+		fileDeletedEventType: decodeFileDeleted,
+		fileCleanedEventType: decodeFileCleaned,
+	}
+)
+
+// HandleMessage decodes the event and applies it, unless the inbox has already processed an event with the same idempotency key.
+func HandleMessage(ctx context.Context, box *inbox.Inbox, files *mongo.Collection, message *sarama.ConsumerMessage) error {
+	event, err := DecodeMessage(message)
+	if err != nil {
+		// a retry decodes the same bytes again
+		return fmt.Errorf("%w: %w", ErrMalformedEvent, err)
+	}
+
+	key := event.IdempotencyKey()
+	processed, err := box.Process(ctx, key, func(ctx context.Context) error {
+		return event.Apply(ctx, files)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+		return fmt.Errorf("failed to process event %s: %w", key, err)
+	}
+	if !processed {
+		messageLogger(message).Info("Skipped event that was already processed", "idempotency_key", key.String())
 	}
-	fmt.Printf("Consumed FileStored: %+v\n", fileStored)
 
 	return nil
 }
+
+func DecodeMessage(message *sarama.ConsumerMessage) (Event, error) {
+	eventType := HeaderValue(message, HeaderEventType)
+	if eventType == "" {
+		// events published before the miner set headers are always FileStored
+		eventType = fileStoredEventType
+	}
+
+	decoder, ok := eventDecoders[eventType]
+	if !ok {
+		return nil, fmt.Errorf("event type %s is not supported", eventType)
+	}
+
+	messageLogger(message).Info("Consuming event",
+		logging.KeyEventType, eventType,
+		"schema_version", HeaderValue(message, HeaderSchemaVersion),
+		"snapshot", HeaderValue(message, HeaderSnapshot) == "true",
+		"source", HeaderValue(message, HeaderSource))
+	return decoder(message)
+}
+
+// eventVersion formats the time of the change, an event published again for the same change has the same time.
+func eventVersion(timestamp *timestamppb.Timestamp) string {
+	return timestamp.AsTime().UTC().Format(time.RFC3339Nano)
+}
+
+type fileStored struct{ *api.FileStored }
+
+func decodeFileStored(message *sarama.ConsumerMessage) (Event, error) {
+	fileStored := fileStored{&api.FileStored{}}
+	err := proto.Unmarshal(message.Value, fileStored.FileStored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	messageLogger(message).Info("Consumed FileStored", logging.Document(fileStored.FileStored))
+
+	return fileStored, nil
+}
+
+// IdempotencyKey uses the time the file was stored, so that a snapshot of the file has the same key as the change event.
+func (e fileStored) IdempotencyKey() inbox.Key {
+	return inbox.Key{FileId: e.GetFileId(), EventType: fileStoredEventType, Version: eventVersion(e.GetStoredAt())}
+}
+
+func (e fileStored) Apply(ctx context.Context, files *mongo.Collection) error {
+	projected, err := readmodel.ProjectFileStored(ctx, files, e.FileStored)
+	if err != nil {
+		return err
+	}
+	if !projected {
+		slog.Info("The file was deleted or a newer version of it is already projected", logging.KeyFileId, e.GetFileId())
+	}
+
+	return nil
+}
+
+type fileDeleted struct{ *api.FileDeleted }
+
+func decodeFileDeleted(message *sarama.ConsumerMessage) (Event, error) {
+	fileDeleted := fileDeleted{&api.FileDeleted{}}
+	err := proto.Unmarshal(message.Value, fileDeleted.FileDeleted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	messageLogger(message).Info("Consumed FileDeleted", logging.Document(fileDeleted.FileDeleted))
+
+	return fileDeleted, nil
+}
+
+func (e fileDeleted) IdempotencyKey() inbox.Key {
+	return inbox.Key{FileId: e.GetFileId(), EventType: fileDeletedEventType, Version: eventVersion(e.GetDeletedAt())}
+}
+
+func (e fileDeleted) Apply(ctx context.Context, files *mongo.Collection) error {
+	return readmodel.RemoveFile(ctx, files, e.GetFileId(), e.GetDeletedAt().AsTime())
+}
+
+type fileCleaned struct{ *api.FileCleaned }
+
+func decodeFileCleaned(message *sarama.ConsumerMessage) (Event, error) {
+	fileCleaned := fileCleaned{&api.FileCleaned{}}
+	err := proto.Unmarshal(message.Value, fileCleaned.FileCleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+	messageLogger(message).Info("Consumed FileCleaned", logging.Document(fileCleaned.FileCleaned))
+
+	return fileCleaned, nil
+}
+
+func (e fileCleaned) IdempotencyKey() inbox.Key {
+	return inbox.Key{FileId: e.GetFileId(), EventType: fileCleanedEventType, Version: eventVersion(e.GetCleanedAt())}
+}
+
+// Apply removes the file. An incomplete upload was never projected, the tombstone only matters if a FileStored of it was published anyway.
+func (e fileCleaned) Apply(ctx context.Context, files *mongo.Collection) error {
+	return readmodel.RemoveFile(ctx, files, e.GetFileId(), e.GetCleanedAt().AsTime())
+}
@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/inbox"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/consumer/readmodel"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+const testFileId = "4b4f6c3e-3b1a-4c8e-9f3a-2f1d0c9b8a7e"
+
+func newFileStoredMessage(t *testing.T, storedAt time.Time) *sarama.ConsumerMessage {
+	t.Helper()
+
+	event := &api.FileStored{}
+	event.SetFileId(testFileId)
+	event.SetCreatedAt(timestamppb.New(storedAt.Add(-time.Second)))
+	event.SetStoredAt(timestamppb.New(storedAt))
+	event.SetSize(42)
+	event.SetMediaType("text/plain")
+	event.SetExtension(".txt")
+	value, err := proto.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to marshal event: %v", err)
+	}
+
+	return &sarama.ConsumerMessage{
+		Topic: "file-stored",
+		Key:   []byte(testFileId),
+		Value: value,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderEventType), Value: []byte(fileStoredEventType)},
+		},
+	}
+}
+
+// A redelivered event, e.g. after a rebalance or from the snapshot of the miner, is skipped by the inbox.
+func TestHandleMessageAppliesRedeliveredEventOnce(t *testing.T) {
+	ctx := context.Background()
+	db := mongodbtest.Connect(t)
+	files := readmodel.FileCollection(db)
+	inboxCollection := inbox.Collection(db)
+	box := inbox.New(inboxCollection, time.Hour)
+	message := newFileStoredMessage(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	if err := HandleMessage(ctx, box, files, message); err != nil {
+		t.Fatalf("first HandleMessage failed: %v", err)
+	}
+	first := fetchFile(t, files)
+	if err := HandleMessage(ctx, box, files, message); err != nil {
+		t.Fatalf("second HandleMessage failed: %v", err)
+	}
+	second := fetchFile(t, files)
+
+	if first.Size != 42 || first.MediaType != "text/plain" {
+		t.Fatalf("projected %+v, want the file of the event", first)
+	}
+	// the projection sets ProjectedAt each time it writes the file
+	if !second.ProjectedAt.Equal(first.ProjectedAt) {
+		t.Fatalf("the file was projected again at %v after %v, want it to be written once", second.ProjectedAt, first.ProjectedAt)
+	}
+	entries, err := inbox.FetchEntries(ctx, inboxCollection)
+	if err != nil {
+		t.Fatalf("FetchEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Duplicates != 1 {
+		t.Fatalf("inbox contains %+v, want one entry with one duplicate", entries)
+	}
+}
+
+func fetchFile(t *testing.T, files *mongo.Collection) readmodel.File {
+	t.Helper()
+
+	var file readmodel.File
+	if err := files.FindOne(context.Background(), bson.M{"_id": testFileId}).Decode(&file); err != nil {
+		t.Fatalf("failed to fetch projected file: %v", err)
+	}
+
+	return file
+}
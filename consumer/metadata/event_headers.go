@@ -0,0 +1,25 @@
+package metadata
+
+import "github.com/IBM/sarama"
+
+// Record headers set by the miner for every event
+const (
+	HeaderEventType       = "event-type"
+	HeaderSchemaVersion   = "schema-version"
+	HeaderSource          = "source"
+	HeaderClusterTime     = "cluster-time"
+	HeaderResumeTokenHash = "resume-token-hash"
+	HeaderCorrelationId   = "correlation-id"
+	HeaderSnapshot        = "snapshot"
+)
+
+// HeaderValue returns the value of the record header or an empty string if the message does not have the header.
+func HeaderValue(message *sarama.ConsumerMessage, key string) string {
+	for _, header := range message.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+// Record headers of a message on a retry or the dead letter topic in addition to the headers of the event
+const (
+	// HeaderErrorReason is the error of the last attempt
+	HeaderErrorReason = "error-reason"
+	// HeaderFailedAt is the time of the last attempt in RFC 3339
+	HeaderFailedAt = "failed-at"
+	// HeaderAttempts is the number of failed attempts
+	HeaderAttempts = "attempts"
+	// HeaderRetryAt is the time in RFC 3339 the message is handled again
+	HeaderRetryAt = "retry-at"
+	// HeaderOriginalTopic, HeaderOriginalPartition and HeaderOriginalOffset are the position of the message on the main topic
+	HeaderOriginalTopic     = "original-topic"
+	HeaderOriginalPartition = "original-partition"
+	HeaderOriginalOffset    = "original-offset"
+)
+
+// ErrMalformedEvent is returned for a message that fails on every attempt, it is dead lettered without retries.
+var ErrMalformedEvent = errors.New("malformed event")
+
+// ForwardRetryInterval is the wait before a failed publish to a retry or the dead letter topic is repeated
+var ForwardRetryInterval = time.Second
+
+// Retrier publishes failed messages to the retry and the dead letter topics, it also replays dead letters.
+type Retrier struct {
+	producer sarama.SyncProducer
+	// topic of the file events, the retry topics are named after it
+	topic string
+	// delays are the waits before the retries of a failed message, each retry has its own topic
+	delays []time.Duration
+	// deadLetterTopic receives the messages that failed on the last retry
+	deadLetterTopic string
+}
+
+// failureHeaders are replaced each time the message fails, the original position is kept from the first failure
+var failureHeaders = map[string]bool{
+	HeaderErrorReason: true,
+	HeaderFailedAt:    true,
+	HeaderAttempts:    true,
+	HeaderRetryAt:     true,
+}
+
+// originalHeaders are removed when a dead letter is replayed, the replayed message has a new position
+var originalHeaders = map[string]bool{
+	HeaderOriginalTopic:     true,
+	HeaderOriginalPartition: true,
+	HeaderOriginalOffset:    true,
+}
+
+// RetryTopic returns the topic of the retry after the delay, e.g. file-stored.retry.1m.
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatDelay(delay)
+}
+
+// RetryTopics returns the topics of all retries in the order they are tried.
+func (c Config) RetryTopics() []string {
+	topics := make([]string, len(c.Retry.Delays))
+	for i, delay := range c.Retry.Delays {
+		topics[i] = RetryTopic(c.Kafka.Topic, delay)
+	}
+
+	return topics
+}
+
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return delay.String()
+	}
+}
+
+// NewRetrier creates the producer of the retry and the dead letter topic.
+func NewRetrier(cfg Config) (*Retrier, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	// the file id stays the key, so the retries of a file land on the same partition
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+
+	producer, err := sarama.NewSyncProducer(cfg.Kafka.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retry producer: %w", err)
+	}
+
+	return &Retrier{
+		producer:        producer,
+		topic:           cfg.Kafka.Topic,
+		delays:          cfg.Retry.Delays,
+		deadLetterTopic: cfg.Retry.DeadLetterTopic,
+	}, nil
+}
+
+func (r *Retrier) Close() {
+	if err := r.producer.Close(); err != nil {
+		slog.Warn("Failed to close retry producer", logging.Error(err))
+	}
+}
+
+// waitForRetry waits until the message of a retry topic is due. It returns false if the session ended before,
+// the message is then delivered again after the rebalance.
+func waitForRetry(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	retryAt, err := time.Parse(time.RFC3339, HeaderValue(message, HeaderRetryAt))
+	if err != nil {
+		return true
+	}
+
+	wait := time.Until(retryAt)
+	if wait <= 0 {
+		return true
+	}
+
+	messageLogger(message).Info("Waiting for retry", "retry_at", retryAt)
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
+
+// forwardFailedMessage publishes the failed message to the next retry topic, or to the dead letter topic after the last retry.
+// A failed publish is repeated, so the message is not marked before it was forwarded. It returns false if the session ended before.
+func (r *Retrier) forwardFailedMessage(ctx context.Context, message *sarama.ConsumerMessage, reason error) bool {
+	failed := r.newFailedMessage(message, reason, time.Now().UTC())
+	for {
+		_, _, err := r.producer.SendMessage(failed)
+		if err == nil {
+			messageLogger(message).Warn("Failed message forwarded", "target_topic", failed.Topic, logging.Error(reason))
+			return true
+		}
+
+		messageLogger(message).Error("Error forwarding failed message", "target_topic", failed.Topic, logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(ForwardRetryInterval):
+		}
+	}
+}
+
+func (r *Retrier) newFailedMessage(message *sarama.ConsumerMessage, reason error, failedAt time.Time) *sarama.ProducerMessage {
+	attempts := 1
+	if previous, err := strconv.Atoi(HeaderValue(message, HeaderAttempts)); err == nil {
+		attempts = previous + 1
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+7)
+	for _, header := range message.Headers {
+		if !failureHeaders[string(header.Key)] {
+			headers = append(headers, *header)
+		}
+	}
+	if HeaderValue(message, HeaderOriginalTopic) == "" {
+		headers = append(headers,
+			sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(message.Topic)},
+			sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(strconv.Itoa(int(message.Partition)))},
+			sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(strconv.FormatInt(message.Offset, 10))},
+		)
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderErrorReason), Value: []byte(reason.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(failedAt.Format(time.RFC3339))},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	target := r.deadLetterTopic
+	if attempts <= len(r.delays) && !errors.Is(reason, ErrMalformedEvent) {
+		delay := r.delays[attempts-1]
+		target = RetryTopic(r.topic, delay)
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderRetryAt), Value: []byte(failedAt.Add(delay).Format(time.RFC3339))})
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:   target,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+}
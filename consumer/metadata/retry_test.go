@@ -0,0 +1,218 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+var (
+	testFailedAt = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	errHandle    = errors.New("projection failed")
+)
+
+func newTestRetrier() *Retrier {
+	return &Retrier{
+		topic:           "file-stored",
+		delays:          []time.Duration{time.Minute, 10 * time.Minute},
+		deadLetterTopic: "file-stored.dlt",
+	}
+}
+
+func newConsumerMessage(topic string, headers ...string) *sarama.ConsumerMessage {
+	message := &sarama.ConsumerMessage{Topic: topic, Partition: 3, Offset: 42, Key: []byte(testFileId), Value: []byte("event")}
+	for i := 0; i+1 < len(headers); i += 2 {
+		message.Headers = append(message.Headers, &sarama.RecordHeader{Key: []byte(headers[i]), Value: []byte(headers[i+1])})
+	}
+	return message
+}
+
+func TestRetryTopic(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  string
+	}{
+		{delay: 30 * time.Second, want: "file-stored.retry.30s"},
+		{delay: time.Minute, want: "file-stored.retry.1m"},
+		{delay: 90 * time.Minute, want: "file-stored.retry.90m"},
+		{delay: 2 * time.Hour, want: "file-stored.retry.2h"},
+		{delay: 1500 * time.Millisecond, want: "file-stored.retry.1.5s"},
+	}
+
+	for _, test := range tests {
+		if got := RetryTopic("file-stored", test.delay); got != test.want {
+			t.Errorf("RetryTopic of %v is %s, want %s", test.delay, got, test.want)
+		}
+	}
+}
+
+func TestNewFailedMessageChoosesTopicOfAttempt(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     *sarama.ConsumerMessage
+		reason      error
+		wantTopic   string
+		wantAttempt string
+		wantRetryAt string
+	}{
+		{name: "first failure", message: newConsumerMessage("file-stored"), reason: errHandle,
+			wantTopic: "file-stored.retry.1m", wantAttempt: "1", wantRetryAt: "2024-01-01T12:01:00Z"},
+		{name: "failure of the first retry", message: newConsumerMessage("file-stored.retry.1m", HeaderAttempts, "1"), reason: errHandle,
+			wantTopic: "file-stored.retry.10m", wantAttempt: "2", wantRetryAt: "2024-01-01T12:10:00Z"},
+		{name: "failure of the last retry", message: newConsumerMessage("file-stored.retry.10m", HeaderAttempts, "2"), reason: errHandle,
+			wantTopic: "file-stored.dlt", wantAttempt: "3"},
+		{name: "malformed event", message: newConsumerMessage("file-stored"), reason: fmt.Errorf("%w: unknown type", ErrMalformedEvent),
+			wantTopic: "file-stored.dlt", wantAttempt: "1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed := newTestRetrier().newFailedMessage(test.message, test.reason, testFailedAt)
+
+			if failed.Topic != test.wantTopic {
+				t.Fatalf("topic is %s, want %s", failed.Topic, test.wantTopic)
+			}
+			if attempts := producerHeaders(failed)[HeaderAttempts]; len(attempts) != 1 || attempts[0] != test.wantAttempt {
+				t.Fatalf("attempts are %v, want %s", attempts, test.wantAttempt)
+			}
+			retryAt := producerHeaders(failed)[HeaderRetryAt]
+			if (test.wantRetryAt == "" && len(retryAt) != 0) || (test.wantRetryAt != "" && (len(retryAt) != 1 || retryAt[0] != test.wantRetryAt)) {
+				t.Fatalf("retry at is %v, want %q", retryAt, test.wantRetryAt)
+			}
+			if string(encode(t, failed.Key)) != testFileId || string(encode(t, failed.Value)) != "event" {
+				t.Fatal("the key or the value of the message changed")
+			}
+		})
+	}
+}
+
+// A message that fails again on a retry topic keeps the position of the first failure and the headers of the event,
+// its failure headers describe only the last failure.
+func TestNewFailedMessageReplacesFailureHeaders(t *testing.T) {
+	message := newConsumerMessage("file-stored.retry.1m",
+		HeaderEventType, "FileStored",
+		HeaderOriginalTopic, "file-stored",
+		HeaderOriginalPartition, "1",
+		HeaderOriginalOffset, "7",
+		HeaderErrorReason, "first failure",
+		HeaderFailedAt, "2024-01-01T11:59:00Z",
+		HeaderAttempts, "1",
+		HeaderRetryAt, "2024-01-01T12:00:00Z",
+	)
+
+	headers := producerHeaders(newTestRetrier().newFailedMessage(message, errHandle, testFailedAt))
+
+	want := map[string]string{
+		HeaderEventType:         "FileStored",
+		HeaderOriginalTopic:     "file-stored",
+		HeaderOriginalPartition: "1",
+		HeaderOriginalOffset:    "7",
+		HeaderErrorReason:       errHandle.Error(),
+		HeaderFailedAt:          "2024-01-01T12:00:00Z",
+		HeaderAttempts:          "2",
+		HeaderRetryAt:           "2024-01-01T12:10:00Z",
+	}
+	assertHeaders(t, headers, want)
+}
+
+func TestNewFailedMessageRecordsOriginalPositionOfFirstFailure(t *testing.T) {
+	headers := producerHeaders(newTestRetrier().newFailedMessage(newConsumerMessage("file-stored"), errHandle, testFailedAt))
+
+	for key, want := range map[string]string{HeaderOriginalTopic: "file-stored", HeaderOriginalPartition: "3", HeaderOriginalOffset: "42"} {
+		if got := headers[key]; len(got) != 1 || got[0] != want {
+			t.Errorf("header %s is %v, want %s", key, got, want)
+		}
+	}
+}
+
+func TestWaitForRetry(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		message *sarama.ConsumerMessage
+		want    bool
+	}{
+		{name: "message of the main topic", ctx: cancelled, message: newConsumerMessage("file-stored"), want: true},
+		{name: "retry is due", ctx: cancelled, message: newConsumerMessage("file-stored.retry.1m", HeaderRetryAt, time.Now().Add(-time.Minute).Format(time.RFC3339)), want: true},
+		{name: "session ends before the retry is due", ctx: cancelled, message: newConsumerMessage("file-stored.retry.1m", HeaderRetryAt, time.Now().Add(time.Hour).Format(time.RFC3339)), want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := waitForRetry(test.ctx, test.message); got != test.want {
+				t.Fatalf("waitForRetry returned %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// A replayed dead letter starts again with the first attempt at a new position on the main topic.
+func TestReplayDeadLetterRemovesFailureHeaders(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	retrier := newTestRetrier()
+	retrier.producer = producer
+	deadLetter := DeadLetter{
+		Key:   []byte(testFileId),
+		Value: []byte("event"),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(HeaderEventType), Value: []byte("FileStored")},
+			{Key: []byte(HeaderCorrelationId), Value: []byte("correlation")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("file-stored")},
+			{Key: []byte(HeaderOriginalPartition), Value: []byte("1")},
+			{Key: []byte(HeaderOriginalOffset), Value: []byte("7")},
+			{Key: []byte(HeaderErrorReason), Value: []byte("failed")},
+			{Key: []byte(HeaderFailedAt), Value: []byte("2024-01-01T12:00:00Z")},
+			{Key: []byte(HeaderAttempts), Value: []byte("3")},
+		},
+	}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		if message.Topic != "file-stored" {
+			return fmt.Errorf("topic is %s, want file-stored", message.Topic)
+		}
+		assertHeaders(t, producerHeaders(message), map[string]string{HeaderEventType: "FileStored", HeaderCorrelationId: "correlation"})
+		return nil
+	})
+
+	if err := retrier.ReplayDeadLetter(deadLetter); err != nil {
+		t.Fatalf("ReplayDeadLetter failed: %v", err)
+	}
+}
+
+func producerHeaders(message *sarama.ProducerMessage) map[string][]string {
+	headers := map[string][]string{}
+	for _, header := range message.Headers {
+		headers[string(header.Key)] = append(headers[string(header.Key)], string(header.Value))
+	}
+	return headers
+}
+
+func assertHeaders(t *testing.T, headers map[string][]string, want map[string]string) {
+	t.Helper()
+
+	if len(headers) != len(want) {
+		t.Errorf("message has the headers %v, want %v", headers, want)
+	}
+	for key, value := range want {
+		if got := headers[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("header %s is %v, want %s", key, got, value)
+		}
+	}
+}
+
+func encode(t *testing.T, encoder sarama.Encoder) []byte {
+	t.Helper()
+
+	encoded, err := encoder.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return encoded
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+)
+
+var (
+	// ErrChecksumMissing is returned for files that were stored before the producer computed a checksum
+	ErrChecksumMissing = errors.New("file has no checksum")
+	// ErrChecksumMismatch is returned if the downloaded content differs from the stored content
+	ErrChecksumMismatch = errors.New("content does not match the checksum")
+)
+
+// VerifyChecksum reads the downloaded content completely and compares it with the checksum of the FileStored event.
+// The CRC32C is only compared if the event carries one.
+func VerifyChecksum(content io.Reader, checksum *api.Checksum) error {
+	if checksum == nil || len(checksum.GetSha256()) == 0 {
+		return ErrChecksumMissing
+	}
+
+	sha256Hash := sha256.New()
+	crc32cHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, crc32cHash), content); err != nil {
+		return fmt.Errorf("failed to read content: %w", err)
+	}
+
+	if !bytes.Equal(sha256Hash.Sum(nil), checksum.GetSha256()) {
+		return fmt.Errorf("%w: sha256 %x, expected %x", ErrChecksumMismatch, sha256Hash.Sum(nil), checksum.GetSha256())
+	}
+	if checksum.HasCrc32C() && crc32cHash.Sum32() != checksum.GetCrc32C() {
+		return fmt.Errorf("%w: crc32c %08x, expected %08x", ErrChecksumMismatch, crc32cHash.Sum32(), checksum.GetCrc32C())
+	}
+
+	return nil
+}
+
+// VerifyDownload downloads the file from the API of the producer and verifies its content with VerifyChecksum.
+// A file without checksum is not downloaded.
+func VerifyDownload(ctx context.Context, client *http.Client, producerURL string, fileId string, checksum *api.Checksum) error {
+	if checksum == nil || len(checksum.GetSha256()) == 0 {
+		return ErrChecksumMissing
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, producerURL+"/files/"+url.PathEscape(fileId), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to download file %s: %w", fileId, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download file %s: %s", fileId, response.Status)
+	}
+
+	return VerifyChecksum(response.Body, checksum)
+}
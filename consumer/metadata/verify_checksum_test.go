@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+)
+
+const testContent = "content of the stored file"
+
+func newChecksum(content string, withCRC32C bool) *api.Checksum {
+	sha256Sum := sha256.Sum256([]byte(content))
+	checksum := &api.Checksum{}
+	checksum.SetSha256(sha256Sum[:])
+	if withCRC32C {
+		checksum.SetCrc32C(crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli)))
+	}
+	return checksum
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	withoutSHA256 := &api.Checksum{}
+	withoutSHA256.SetCrc32C(1)
+	differentCRC32C := newChecksum(testContent, true)
+	differentCRC32C.SetCrc32C(differentCRC32C.GetCrc32C() + 1)
+
+	tests := []struct {
+		name     string
+		content  string
+		checksum *api.Checksum
+		want     error
+	}{
+		{name: "sha256 matches", content: testContent, checksum: newChecksum(testContent, false)},
+		{name: "sha256 and crc32c match", content: testContent, checksum: newChecksum(testContent, true)},
+		{name: "sha256 differs", content: testContent + ".", checksum: newChecksum(testContent, false), want: ErrChecksumMismatch},
+		{name: "crc32c differs", content: testContent, checksum: differentCRC32C, want: ErrChecksumMismatch},
+		{name: "no checksum", content: testContent, checksum: nil, want: ErrChecksumMissing},
+		{name: "no sha256", content: testContent, checksum: withoutSHA256, want: ErrChecksumMissing},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := VerifyChecksum(strings.NewReader(test.content), test.checksum); !errors.Is(err, test.want) {
+				t.Fatalf("VerifyChecksum returned %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/files/stored" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testContent))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	if err := VerifyDownload(ctx, server.Client(), server.URL, "stored", newChecksum(testContent, true)); err != nil {
+		t.Fatalf("VerifyDownload of matching content returned %v, want nil", err)
+	}
+	if err := VerifyDownload(ctx, server.Client(), server.URL, "stored", newChecksum("other content", true)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("VerifyDownload of different content returned %v, want %v", err, ErrChecksumMismatch)
+	}
+	if err := VerifyDownload(ctx, server.Client(), server.URL, "unknown", newChecksum(testContent, true)); err == nil || errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("VerifyDownload of an unknown file returned %v, want a download error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package readmodel
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// RegisterQueryAPI registers the queries of the read model. The read model is eventually consistent with the producer,
+// a file is listed after its FileStored event was consumed.
+func RegisterQueryAPI(mux *http.ServeMux, db mongodb.Connection) {
+	collection := FileCollection(db)
+
+	mux.Handle("GET /files", ListFilesHandler(collection))
+	mux.Handle("GET /files/summary", SummaryHandler(collection))
+	mux.Handle("GET /files/media-types", MediaTypesHandler(collection))
+}
+
+// ListFilesHandler lists the most recently stored files, optionally of one media type.
+func ListFilesHandler(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := parseLimit(r.URL.Query().Get("limit"))
+		if err != nil {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxLimit), http.StatusBadRequest)
+			return
+		}
+
+		files, err := ListFiles(r.Context(), collection, r.URL.Query().Get("mediaType"), limit)
+		if err != nil {
+			slog.Error("Error listing files", logging.Error(err))
+			http.Error(w, "failed to list files", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, files)
+	}
+}
+
+// SummaryHandler returns the number and the total size of the files, optionally of one media type.
+func SummaryHandler(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, err := SummarizeFiles(r.Context(), collection, r.URL.Query().Get("mediaType"))
+		if err != nil {
+			slog.Error("Error summarizing files", logging.Error(err))
+			http.Error(w, "failed to summarize files", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, summary)
+	}
+}
+
+// MediaTypesHandler returns the number and the total size of the files of each media type.
+func MediaTypesHandler(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summaries, err := SummarizeMediaTypes(r.Context(), collection)
+		if err != nil {
+			slog.Error("Error summarizing media types", logging.Error(err))
+			http.Error(w, "failed to summarize media types", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, summaries)
+	}
+}
+
+func parseLimit(value string) (int64, error) {
+	if value == "" {
+		return defaultLimit, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > maxLimit {
+		return 0, strconv.ErrRange
+	}
+
+	return limit, nil
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,132 @@
+package readmodel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: defaultLimit},
+		{value: "1", want: 1},
+		{value: "100", want: maxLimit},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "101", wantErr: true},
+		{value: "ten", wantErr: true},
+		{value: "1.5", wantErr: true},
+	}
+
+	for _, test := range tests {
+		limit, err := parseLimit(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseLimit(%q) returned %d, want an error", test.value, limit)
+			}
+			continue
+		}
+		if err != nil || limit != test.want {
+			t.Errorf("parseLimit(%q) returned %d, %v, want %d", test.value, limit, err, test.want)
+		}
+	}
+}
+
+// unreachableCollection fails every operation after a short server selection.
+func unreachableCollection(t *testing.T) *mongo.Collection {
+	t.Helper()
+
+	clientOptions := options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100 * time.Millisecond)
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return client.Database("consumer").Collection("file")
+}
+
+func serve(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	handler(response, httptest.NewRequest(http.MethodGet, target, nil))
+	return response
+}
+
+func TestQueryHandlersFailWithoutMongoDB(t *testing.T) {
+	collection := unreachableCollection(t)
+	handlers := map[string]http.HandlerFunc{
+		"list files":  ListFilesHandler(collection),
+		"summary":     SummaryHandler(collection),
+		"media types": MediaTypesHandler(collection),
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			if response := serve(handler, "/files"); response.Code != http.StatusInternalServerError {
+				t.Fatalf("status is %d, want %d", response.Code, http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// An invalid limit is rejected before the read model is queried.
+func TestListFilesHandlerRejectsInvalidLimit(t *testing.T) {
+	for _, limit := range []string{"0", "101", "all"} {
+		if response := serve(ListFilesHandler(unreachableCollection(t)), "/files?limit="+limit); response.Code != http.StatusBadRequest {
+			t.Errorf("status of limit %s is %d, want %d", limit, response.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestQueryHandlers(t *testing.T) {
+	ctx := context.Background()
+	collection := FileCollection(mongodbtest.Connect(t))
+	projectFileStored(t, collection, newFileStored(testStoredAt, 42))
+	if err := RemoveFile(ctx, collection, "removed", testStoredAt); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+
+	response := serve(ListFilesHandler(collection), "/files?mediaType=text/plain&limit=5")
+	var files []File
+	decodeResponse(t, response, &files)
+	if len(files) != 1 || files[0].FileId != testFileId {
+		t.Fatalf("listed %+v, want the projected file without the tombstone", files)
+	}
+
+	response = serve(SummaryHandler(collection), "/files/summary")
+	var summary Summary
+	decodeResponse(t, response, &summary)
+	if summary.Count != 1 || summary.TotalSize != 42 {
+		t.Fatalf("summary is %+v, want one file of 42 bytes", summary)
+	}
+
+	response = serve(MediaTypesHandler(collection), "/files/media-types")
+	var summaries []Summary
+	decodeResponse(t, response, &summaries)
+	if len(summaries) != 1 || summaries[0].MediaType != "text/plain" || summaries[0].Count != 1 {
+		t.Fatalf("media types are %+v, want one file of text/plain", summaries)
+	}
+}
+
+func decodeResponse(t *testing.T, response *httptest.ResponseRecorder, value any) {
+	t.Helper()
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("status is %d (%s), want %d", response.Code, response.Body, http.StatusOK)
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
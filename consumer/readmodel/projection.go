@@ -0,0 +1,145 @@
+// Package readmodel keeps a query store of the stored files, it is projected from the file events.
+package readmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+)
+
+// File is a stored file as seen by the consumer. The file id is the _id, so that each file is projected at most once.
+// A removed file stays as tombstone with only DeletedAt, so that a late FileStored of the file does not project it again.
+type File struct {
+	FileId      string    `bson:"_id" json:"fileId"`
+	CreatedAt   time.Time `bson:"CreatedAt" json:"createdAt"`
+	StoredAt    time.Time `bson:"StoredAt" json:"storedAt"`
+	Size        int64     `bson:"Size" json:"size"`
+	MediaType   string    `bson:"MediaType" json:"mediaType"`
+	Extension   string    `bson:"Extension" json:"extension"`
+	ProjectedAt time.Time `bson:"ProjectedAt" json:"projectedAt"`
+	DeletedAt   time.Time `bson:"DeletedAt,omitempty" json:"-"`
+	// Checksum is missing for files that were stored before the producer computed a checksum
+	Checksum *Checksum `bson:"Checksum,omitempty" json:"checksum,omitempty"`
+}
+
+// Checksum of the content as published in FileStored.
+type Checksum struct {
+	SHA256 []byte `bson:"SHA256" json:"sha256"`
+	// CRC32C is stored as int64, BSON has no unsigned integers
+	CRC32C *int64 `bson:"CRC32C,omitempty" json:"crc32c,omitempty"`
+}
+
+func newChecksum(checksum *api.Checksum) *Checksum {
+	if checksum == nil {
+		return nil
+	}
+
+	projected := &Checksum{SHA256: checksum.GetSha256()}
+	if checksum.HasCrc32C() {
+		crc := int64(checksum.GetCrc32C())
+		projected.CRC32C = &crc
+	}
+	return projected
+}
+
+// Event returns the checksum as published in FileStored, so that downloaded content is verified against the read model.
+func (c *Checksum) Event() *api.Checksum {
+	if c == nil {
+		return nil
+	}
+
+	checksum := &api.Checksum{}
+	checksum.SetSha256(c.SHA256)
+	if c.CRC32C != nil {
+		checksum.SetCrc32C(uint32(*c.CRC32C))
+	}
+	return checksum
+}
+
+// tombstone is the document of a removed file.
+type tombstone struct {
+	FileId    string    `bson:"_id"`
+	DeletedAt time.Time `bson:"DeletedAt"`
+}
+
+// notDeleted returns the filter that excludes the tombstones from a query.
+func notDeleted() bson.M {
+	return bson.M{"DeletedAt": bson.M{"$exists": false}}
+}
+
+// FileCollection returns the collection of the read model, it is owned by the consumer and not shared with the producer.
+func FileCollection(db mongodb.Connection) *mongo.Collection {
+	return db.Database("consumer").Collection("file")
+}
+
+// EnsureIndexes creates the indexes of the queries, creating an existing index does nothing.
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "StoredAt", Value: -1}}},
+		{Keys: bson.D{{Key: "MediaType", Value: 1}, {Key: "StoredAt", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create read model indexes: %w", err)
+	}
+
+	return nil
+}
+
+// ProjectFileStored inserts the file or replaces it with the same values if the event is delivered again.
+// An event that is older than the projected file is ignored, the snapshot of the miner can publish a file again.
+// An event of a removed file is ignored as well, a retried FileStored can be handled after the FileDeleted of the file.
+// It returns false if the event was ignored.
+// The read and the write run in the transaction of the inbox. The consumer of a retry topic can handle an event of the same file
+// at the same time, the transaction that writes second fails with a write conflict and is retried.
+func ProjectFileStored(ctx context.Context, collection *mongo.Collection, event *api.FileStored) (bool, error) {
+	file := File{
+		FileId:      event.GetFileId(),
+		CreatedAt:   event.GetCreatedAt().AsTime(),
+		StoredAt:    event.GetStoredAt().AsTime(),
+		Size:        event.GetSize(),
+		MediaType:   event.GetMediaType(),
+		Extension:   event.GetExtension(),
+		ProjectedAt: time.Now().UTC(),
+		Checksum:    newChecksum(event.GetChecksum()),
+	}
+
+	var projected File
+	err := collection.FindOne(ctx, bson.M{"_id": file.FileId}).Decode(&projected)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, fmt.Errorf("failed to fetch projected file: %w", err)
+	}
+	if err == nil && (!projected.DeletedAt.IsZero() || projected.StoredAt.After(file.StoredAt)) {
+		return false, nil
+	}
+
+	_, err = collection.ReplaceOne(ctx, bson.M{"_id": file.FileId}, file, options.Replace().SetUpsert(true))
+	if err != nil {
+		return false, fmt.Errorf("failed to project stored file: %w", err)
+	}
+
+	return true, nil
+}
+
+// RemoveFile replaces the file with a tombstone, a file that was never projected gets a tombstone as well.
+// The tombstones are never removed, a dead letter of the file can be replayed at any time.
+func RemoveFile(ctx context.Context, collection *mongo.Collection, fileId string, deletedAt time.Time) error {
+	file := tombstone{
+		FileId:    fileId,
+		DeletedAt: deletedAt,
+	}
+
+	_, err := collection.ReplaceOne(ctx, bson.M{"_id": fileId}, file, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to remove file from read model: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package readmodel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+const testFileId = "4b4f6c3e-3b1a-4c8e-9f3a-2f1d0c9b8a7e"
+
+var testStoredAt = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newFileStored(storedAt time.Time, size int64) *api.FileStored {
+	event := &api.FileStored{}
+	event.SetFileId(testFileId)
+	event.SetCreatedAt(timestamppb.New(storedAt.Add(-time.Second)))
+	event.SetStoredAt(timestamppb.New(storedAt))
+	event.SetSize(size)
+	event.SetMediaType("text/plain")
+	event.SetExtension(".txt")
+	return event
+}
+
+func projectFileStored(t *testing.T, collection *mongo.Collection, event *api.FileStored) bool {
+	t.Helper()
+
+	projected, err := ProjectFileStored(context.Background(), collection, event)
+	if err != nil {
+		t.Fatalf("ProjectFileStored failed: %v", err)
+	}
+	return projected
+}
+
+func fetchFile(t *testing.T, collection *mongo.Collection) File {
+	t.Helper()
+
+	var file File
+	if err := collection.FindOne(context.Background(), bson.M{"_id": testFileId}).Decode(&file); err != nil {
+		t.Fatalf("failed to fetch file: %v", err)
+	}
+	return file
+}
+
+func TestProjectFileStored(t *testing.T) {
+	collection := FileCollection(mongodbtest.Connect(t))
+
+	if !projectFileStored(t, collection, newFileStored(testStoredAt, 42)) {
+		t.Fatal("the file was not projected")
+	}
+
+	file := fetchFile(t, collection)
+	if file.Size != 42 || file.MediaType != "text/plain" || !file.StoredAt.Equal(testStoredAt) || !file.DeletedAt.IsZero() {
+		t.Fatalf("projected %+v, want the file of the event", file)
+	}
+}
+
+// The snapshot of the miner can publish a file again after a newer version of it was projected.
+func TestProjectFileStoredIgnoresOlderEvent(t *testing.T) {
+	collection := FileCollection(mongodbtest.Connect(t))
+	projectFileStored(t, collection, newFileStored(testStoredAt, 42))
+
+	if projectFileStored(t, collection, newFileStored(testStoredAt.Add(-time.Minute), 7)) {
+		t.Fatal("the older event was projected")
+	}
+
+	if file := fetchFile(t, collection); file.Size != 42 {
+		t.Fatalf("projected size is %d, want the size of the newer event", file.Size)
+	}
+}
+
+func TestProjectFileStoredReplacesWithNewerEvent(t *testing.T) {
+	collection := FileCollection(mongodbtest.Connect(t))
+	projectFileStored(t, collection, newFileStored(testStoredAt, 42))
+
+	if !projectFileStored(t, collection, newFileStored(testStoredAt.Add(time.Minute), 7)) {
+		t.Fatal("the newer event was not projected")
+	}
+
+	if file := fetchFile(t, collection); file.Size != 7 {
+		t.Fatalf("projected size is %d, want the size of the newer event", file.Size)
+	}
+}
+
+// A retried FileStored can be handled after the FileDeleted of the file.
+func TestProjectFileStoredIgnoresRemovedFile(t *testing.T) {
+	ctx := context.Background()
+	collection := FileCollection(mongodbtest.Connect(t))
+	if err := RemoveFile(ctx, collection, testFileId, testStoredAt.Add(time.Hour)); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+
+	if projectFileStored(t, collection, newFileStored(testStoredAt.Add(2*time.Hour), 42)) {
+		t.Fatal("the file was projected again after it was removed")
+	}
+
+	files, err := ListFiles(ctx, collection, "", maxLimit)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("listed %+v, want no file", files)
+	}
+}
+
+func TestRemoveFileReplacesFileWithTombstone(t *testing.T) {
+	ctx := context.Background()
+	collection := FileCollection(mongodbtest.Connect(t))
+	projectFileStored(t, collection, newFileStored(testStoredAt, 42))
+	deletedAt := testStoredAt.Add(time.Hour)
+
+	if err := RemoveFile(ctx, collection, testFileId, deletedAt); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+
+	file := fetchFile(t, collection)
+	if !file.DeletedAt.Equal(deletedAt) || file.Size != 0 || file.MediaType != "" {
+		t.Fatalf("file is %+v, want a tombstone deleted at %v", file, deletedAt)
+	}
+}
+
+// A FileDeleted or FileCleaned can be handled before the FileStored of the file, e.g. from a retry topic.
+func TestRemoveFileCreatesTombstoneOfFileNeverProjected(t *testing.T) {
+	collection := FileCollection(mongodbtest.Connect(t))
+
+	if err := RemoveFile(context.Background(), collection, testFileId, testStoredAt); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+
+	if file := fetchFile(t, collection); !file.DeletedAt.Equal(testStoredAt) {
+		t.Fatalf("file is %+v, want a tombstone", file)
+	}
+}
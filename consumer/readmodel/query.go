@@ -0,0 +1,95 @@
+package readmodel
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Summary is the number and the total size of files.
+type Summary struct {
+	MediaType string `bson:"_id,omitempty" json:"mediaType,omitempty"`
+	Count     int64  `bson:"Count" json:"count"`
+	TotalSize int64  `bson:"TotalSize" json:"totalSize"`
+}
+
+// ListFiles returns the most recently stored files first. An empty media type returns files of all media types.
+func ListFiles(ctx context.Context, collection *mongo.Collection, mediaType string, limit int64) ([]File, error) {
+	filter := notDeleted()
+	if mediaType != "" {
+		filter["MediaType"] = mediaType
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "StoredAt", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+
+	files := []File{}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	return files, nil
+}
+
+// SummarizeFiles returns the number and the total size of the files. An empty media type summarizes files of all media types.
+func SummarizeFiles(ctx context.Context, collection *mongo.Collection, mediaType string) (Summary, error) {
+	match := notDeleted()
+	if mediaType != "" {
+		match["MediaType"] = mediaType
+	}
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: match}}}
+	pipeline = append(pipeline, groupBy(nil))
+
+	summaries, err := aggregateSummaries(ctx, collection, pipeline)
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(summaries) == 0 {
+		return Summary{MediaType: mediaType}, nil
+	}
+
+	summary := summaries[0]
+	summary.MediaType = mediaType
+	return summary, nil
+}
+
+// SummarizeMediaTypes returns the number and the total size of the files of each media type, ordered by media type.
+func SummarizeMediaTypes(ctx context.Context, collection *mongo.Collection) ([]Summary, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: notDeleted()}},
+		groupBy("$MediaType"),
+		bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	return aggregateSummaries(ctx, collection, pipeline)
+}
+
+func groupBy(key any) bson.D {
+	return bson.D{{Key: "$group", Value: bson.M{
+		"_id":       key,
+		"Count":     bson.M{"$sum": 1},
+		"TotalSize": bson.M{"$sum": "$Size"},
+	}}}
+}
+
+func aggregateSummaries(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) ([]Summary, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize files: %w", err)
+	}
+
+	summaries := []Summary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, fmt.Errorf("failed to decode summary: %w", err)
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,177 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.31.1
+// source: store_file/v1/file_deleted.proto
+
+package v1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	_ "google.golang.org/protobuf/types/gofeaturespb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A stored file was deleted by a user.
+type FileDeleted struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_FileId      *string                `protobuf:"bytes,1,opt,name=file_id,json=fileId"`
+	xxx_hidden_DeletedAt   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=deleted_at,json=deletedAt"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *FileDeleted) Reset() {
+	*x = FileDeleted{}
+	mi := &file_store_file_v1_file_deleted_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileDeleted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileDeleted) ProtoMessage() {}
+
+func (x *FileDeleted) ProtoReflect() protoreflect.Message {
+	mi := &file_store_file_v1_file_deleted_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *FileDeleted) GetFileId() string {
+	if x != nil {
+		if x.xxx_hidden_FileId != nil {
+			return *x.xxx_hidden_FileId
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *FileDeleted) GetDeletedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.xxx_hidden_DeletedAt
+	}
+	return nil
+}
+
+func (x *FileDeleted) SetFileId(v string) {
+	x.xxx_hidden_FileId = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 2)
+}
+
+func (x *FileDeleted) SetDeletedAt(v *timestamppb.Timestamp) {
+	x.xxx_hidden_DeletedAt = v
+}
+
+func (x *FileDeleted) HasFileId() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *FileDeleted) HasDeletedAt() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_DeletedAt != nil
+}
+
+func (x *FileDeleted) ClearFileId() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_FileId = nil
+}
+
+func (x *FileDeleted) ClearDeletedAt() {
+	x.xxx_hidden_DeletedAt = nil
+}
+
+type FileDeleted_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	// Unique identifier for the file, format a UUID like '123e4567-e89b-12d3-a456-426614174000'
+	FileId *string
+	// Timestamp when the file metadata was deleted
+	DeletedAt *timestamppb.Timestamp
+}
+
+func (b0 FileDeleted_builder) Build() *FileDeleted {
+	m0 := &FileDeleted{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.FileId != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 2)
+		x.xxx_hidden_FileId = b.FileId
+	}
+	x.xxx_hidden_DeletedAt = b.DeletedAt
+	return m0
+}
+
+var File_store_file_v1_file_deleted_proto protoreflect.FileDescriptor
+
+const file_store_file_v1_file_deleted_proto_rawDesc = "" +
+	"\n" +
+	" store_file/v1/file_deleted.proto\x12\rstore_file.v1\x1a!google/protobuf/go_features.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"a\n" +
+	"\vFileDeleted\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x129\n" +
+	"\n" +
+	"deleted_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tdeletedAtB[ZQgithub.com/kinneko-de/sample-transaction-log-tailing-mongodb/golang/store_file/v1\x92\x03\x05\xd2>\x02\x10\x03b\beditionsp\xe8\a"
+
+var file_store_file_v1_file_deleted_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_store_file_v1_file_deleted_proto_goTypes = []any{
+	(*FileDeleted)(nil),           // 0: store_file.v1.FileDeleted
+	(*timestamppb.Timestamp)(nil), // 1: google.protobuf.Timestamp
+}
+var file_store_file_v1_file_deleted_proto_depIdxs = []int32{
+	1, // 0: store_file.v1.FileDeleted.deleted_at:type_name -> google.protobuf.Timestamp
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_store_file_v1_file_deleted_proto_init() }
+func file_store_file_v1_file_deleted_proto_init() {
+	if File_store_file_v1_file_deleted_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_store_file_v1_file_deleted_proto_rawDesc), len(file_store_file_v1_file_deleted_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_store_file_v1_file_deleted_proto_goTypes,
+		DependencyIndexes: file_store_file_v1_file_deleted_proto_depIdxs,
+		MessageInfos:      file_store_file_v1_file_deleted_proto_msgTypes,
+	}.Build()
+	File_store_file_v1_file_deleted_proto = out.File
+	file_store_file_v1_file_deleted_proto_goTypes = nil
+	file_store_file_v1_file_deleted_proto_depIdxs = nil
+}
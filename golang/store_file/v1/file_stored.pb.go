@@ -30,6 +30,7 @@ type FileStored struct {
 	xxx_hidden_Size        int64                  `protobuf:"varint,4,opt,name=size"`
 	xxx_hidden_MediaType   *string                `protobuf:"bytes,5,opt,name=media_type,json=mediaType"`
 	xxx_hidden_Extension   *string                `protobuf:"bytes,6,opt,name=extension"`
+	xxx_hidden_Checksum    *Checksum              `protobuf:"bytes,7,opt,name=checksum"`
 	XXX_raceDetectHookData protoimpl.RaceDetectHookData
 	XXX_presence           [1]uint32
 	unknownFields          protoimpl.UnknownFields
@@ -112,9 +113,16 @@ func (x *FileStored) GetExtension() string {
 	return ""
 }
 
+func (x *FileStored) GetChecksum() *Checksum {
+	if x != nil {
+		return x.xxx_hidden_Checksum
+	}
+	return nil
+}
+
 func (x *FileStored) SetFileId(v string) {
 	x.xxx_hidden_FileId = &v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 6)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 7)
 }
 
 func (x *FileStored) SetCreatedAt(v *timestamppb.Timestamp) {
@@ -127,17 +135,21 @@ func (x *FileStored) SetStoredAt(v *timestamppb.Timestamp) {
 
 func (x *FileStored) SetSize(v int64) {
 	x.xxx_hidden_Size = v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 6)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 7)
 }
 
 func (x *FileStored) SetMediaType(v string) {
 	x.xxx_hidden_MediaType = &v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 6)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 7)
 }
 
 func (x *FileStored) SetExtension(v string) {
 	x.xxx_hidden_Extension = &v
-	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 5, 6)
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 5, 7)
+}
+
+func (x *FileStored) SetChecksum(v *Checksum) {
+	x.xxx_hidden_Checksum = v
 }
 
 func (x *FileStored) HasFileId() bool {
@@ -182,6 +194,13 @@ func (x *FileStored) HasExtension() bool {
 	return protoimpl.X.Present(&(x.XXX_presence[0]), 5)
 }
 
+func (x *FileStored) HasChecksum() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Checksum != nil
+}
+
 func (x *FileStored) ClearFileId() {
 	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
 	x.xxx_hidden_FileId = nil
@@ -210,6 +229,10 @@ func (x *FileStored) ClearExtension() {
 	x.xxx_hidden_Extension = nil
 }
 
+func (x *FileStored) ClearChecksum() {
+	x.xxx_hidden_Checksum = nil
+}
+
 type FileStored_builder struct {
 	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
 
@@ -227,6 +250,9 @@ type FileStored_builder struct {
 	// File extension including a dot, e.g., ".png", ".pdf"
 	// For download generate a random file name and append the extension, ensures that the file name does not contains personal information or internal identifiers
 	Extension *string
+	// Checksum of the content, computed while the file was stored
+	// Verify a downloaded file against it, files stored before the checksum was introduced have none
+	Checksum *Checksum
 }
 
 func (b0 FileStored_builder) Build() *FileStored {
@@ -234,23 +260,134 @@ func (b0 FileStored_builder) Build() *FileStored {
 	b, x := &b0, m0
 	_, _ = b, x
 	if b.FileId != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 6)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 7)
 		x.xxx_hidden_FileId = b.FileId
 	}
 	x.xxx_hidden_CreatedAt = b.CreatedAt
 	x.xxx_hidden_StoredAt = b.StoredAt
 	if b.Size != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 6)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 7)
 		x.xxx_hidden_Size = *b.Size
 	}
 	if b.MediaType != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 6)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 7)
 		x.xxx_hidden_MediaType = b.MediaType
 	}
 	if b.Extension != nil {
-		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 5, 6)
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 5, 7)
 		x.xxx_hidden_Extension = b.Extension
 	}
+	x.xxx_hidden_Checksum = b.Checksum
+	return m0
+}
+
+type Checksum struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Sha256      []byte                 `protobuf:"bytes,1,opt,name=sha256"`
+	xxx_hidden_Crc32C      uint32                 `protobuf:"varint,2,opt,name=crc32c"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *Checksum) Reset() {
+	*x = Checksum{}
+	mi := &file_store_file_v1_file_stored_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Checksum) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Checksum) ProtoMessage() {}
+
+func (x *Checksum) ProtoReflect() protoreflect.Message {
+	mi := &file_store_file_v1_file_stored_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *Checksum) GetSha256() []byte {
+	if x != nil {
+		return x.xxx_hidden_Sha256
+	}
+	return nil
+}
+
+func (x *Checksum) GetCrc32C() uint32 {
+	if x != nil {
+		return x.xxx_hidden_Crc32C
+	}
+	return 0
+}
+
+func (x *Checksum) SetSha256(v []byte) {
+	if v == nil {
+		v = []byte{}
+	}
+	x.xxx_hidden_Sha256 = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 2)
+}
+
+func (x *Checksum) SetCrc32C(v uint32) {
+	x.xxx_hidden_Crc32C = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 2)
+}
+
+func (x *Checksum) HasSha256() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *Checksum) HasCrc32C() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *Checksum) ClearSha256() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Sha256 = nil
+}
+
+func (x *Checksum) ClearCrc32C() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Crc32C = 0
+}
+
+type Checksum_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	// SHA-256 of the content, always set
+	Sha256 []byte
+	// CRC32C (Castagnoli) of the content, only set if the producer is configured to compute it
+	Crc32C *uint32
+}
+
+func (b0 Checksum_builder) Build() *Checksum {
+	m0 := &Checksum{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Sha256 != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 2)
+		x.xxx_hidden_Sha256 = b.Sha256
+	}
+	if b.Crc32C != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 2)
+		x.xxx_hidden_Crc32C = *b.Crc32C
+	}
 	return m0
 }
 
@@ -258,7 +395,7 @@ var File_store_file_v1_file_stored_proto protoreflect.FileDescriptor
 
 const file_store_file_v1_file_stored_proto_rawDesc = "" +
 	"\n" +
-	"\x1fstore_file/v1/file_stored.proto\x12\rstore_file.v1\x1a!google/protobuf/go_features.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xea\x01\n" +
+	"\x1fstore_file/v1/file_stored.proto\x12\rstore_file.v1\x1a!google/protobuf/go_features.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9f\x02\n" +
 	"\n" +
 	"FileStored\x12\x17\n" +
 	"\afile_id\x18\x01 \x01(\tR\x06fileId\x129\n" +
@@ -268,21 +405,27 @@ const file_store_file_v1_file_stored_proto_rawDesc = "" +
 	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x1d\n" +
 	"\n" +
 	"media_type\x18\x05 \x01(\tR\tmediaType\x12\x1c\n" +
-	"\textension\x18\x06 \x01(\tR\textensionB[ZQgithub.com/kinneko-de/sample-transaction-log-tailing-mongodb/golang/store_file/v1\x92\x03\x05\xd2>\x02\x10\x03b\beditionsp\xe8\a"
+	"\textension\x18\x06 \x01(\tR\textension\x123\n" +
+	"\bchecksum\x18\a \x01(\v2\x17.store_file.v1.ChecksumR\bchecksum\":\n" +
+	"\bChecksum\x12\x16\n" +
+	"\x06sha256\x18\x01 \x01(\fR\x06sha256\x12\x16\n" +
+	"\x06crc32c\x18\x02 \x01(\rR\x06crc32cB[ZQgithub.com/kinneko-de/sample-transaction-log-tailing-mongodb/golang/store_file/v1\x92\x03\x05\xd2>\x02\x10\x03b\beditionsp\xe8\a"
 
-var file_store_file_v1_file_stored_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_store_file_v1_file_stored_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_store_file_v1_file_stored_proto_goTypes = []any{
 	(*FileStored)(nil),            // 0: store_file.v1.FileStored
-	(*timestamppb.Timestamp)(nil), // 1: google.protobuf.Timestamp
+	(*Checksum)(nil),              // 1: store_file.v1.Checksum
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
 }
 var file_store_file_v1_file_stored_proto_depIdxs = []int32{
-	1, // 0: store_file.v1.FileStored.created_at:type_name -> google.protobuf.Timestamp
-	1, // 1: store_file.v1.FileStored.stored_at:type_name -> google.protobuf.Timestamp
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	2, // 0: store_file.v1.FileStored.created_at:type_name -> google.protobuf.Timestamp
+	2, // 1: store_file.v1.FileStored.stored_at:type_name -> google.protobuf.Timestamp
+	1, // 2: store_file.v1.FileStored.checksum:type_name -> store_file.v1.Checksum
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_store_file_v1_file_stored_proto_init() }
@@ -296,7 +439,7 @@ func file_store_file_v1_file_stored_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_store_file_v1_file_stored_proto_rawDesc), len(file_store_file_v1_file_stored_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   2,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
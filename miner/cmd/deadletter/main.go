@@ -0,0 +1,133 @@
+// deadletter lists the changes the miner could not convert and redrives them after the conversion was fixed.
+//
+// Usage:
+//
+//	deadletter list [configuration flags]
+//	deadletter redrive -entry <partition>/<offset> [configuration flags]
+//	deadletter redrive -all [configuration flags]
+//
+// The configuration of the miner is loaded like for the miner itself.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/miner/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(ctx, loadConfiguration(flag.NewFlagSet("list", flag.ExitOnError), os.Args[2:]))
+	case "redrive":
+		redriveFlags := flag.NewFlagSet("redrive", flag.ExitOnError)
+		entry := redriveFlags.String("entry", "", "dead letter to redrive as <partition>/<offset>")
+		all := redriveFlags.Bool("all", false, "redrive all dead letters")
+		err = redrive(ctx, loadConfiguration(redriveFlags, os.Args[2:]), *entry, *all)
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadConfiguration parses the flags of the subcommand together with the configuration flags.
+func loadConfiguration(flags *flag.FlagSet, args []string) metadata.Config {
+	cfg := metadata.DefaultConfig()
+	if err := config.LoadWithFlags(flags, args, &cfg); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup("deadletter", cfg.Logging); err != nil {
+		fmt.Printf("Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+
+	return cfg
+}
+
+func printUsage() {
+	fmt.Println("Usage: deadletter list | deadletter redrive (-entry <partition>/<offset> | -all)")
+}
+
+func list(ctx context.Context, cfg metadata.Config) error {
+	deadLetters, err := metadata.ReadDeadLetters(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, deadLetter := range deadLetters {
+		fmt.Printf("%s failed at %s after %s attempts: %s\n  %s\n", entryOf(deadLetter), deadLetter.FailedAt, deadLetter.Attempts, deadLetter.Reason, deadLetter.Change)
+	}
+	fmt.Printf("%d dead letters in %s\n", len(deadLetters), cfg.DeadLetter.Topic)
+
+	return nil
+}
+
+func redrive(ctx context.Context, cfg metadata.Config, entry string, all bool) error {
+	if entry == "" && !all {
+		return fmt.Errorf("either -entry or -all is required")
+	}
+
+	deadLetters, err := metadata.ReadDeadLetters(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	publisher, err := metadata.NewRedrivePublisher(cfg)
+	if err != nil {
+		return err
+	}
+	defer publisher.Close()
+
+	redriven, failed := 0, 0
+	for _, deadLetter := range deadLetters {
+		if !all && entryOf(deadLetter) != entry {
+			continue
+		}
+
+		if err := publisher.RedriveDeadLetter(deadLetter); err != nil {
+			failed++
+			fmt.Printf("Failed to redrive %s: %v\n", entryOf(deadLetter), err)
+			continue
+		}
+		redriven++
+		fmt.Printf("Redriven %s\n", entryOf(deadLetter))
+	}
+
+	if redriven == 0 && failed == 0 {
+		if all {
+			return nil
+		}
+		return fmt.Errorf("dead letter %s not found", entry)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d dead letters could not be redriven", failed, failed+redriven)
+	}
+
+	return nil
+}
+
+func entryOf(deadLetter metadata.DeadLetter) string {
+	return fmt.Sprintf("%d/%d", deadLetter.Partition, deadLetter.Offset)
+}
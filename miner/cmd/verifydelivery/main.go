@@ -0,0 +1,167 @@
+// verifydelivery compares the committed FileStored events with the completed files in MongoDB.
+// It reports files that were published more than once or never and exits with 1 in that case.
+// Without any stored file nothing is verified, which is reported as a failure as well.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/miner/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/google/uuid"
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	idleTimeout = 5 * time.Second
+	// the topic also carries other events of the files
+	fileStoredEventType = string((&api.FileStored{}).ProtoReflect().Descriptor().FullName())
+)
+
+func main() {
+	cfg := metadata.DefaultConfig()
+	if err := config.Load("verifydelivery", os.Args[1:], &cfg); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup("verifydelivery", cfg.Logging); err != nil {
+		fmt.Printf("Error setting up logging: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	published, err := countPublishedEvents(ctx, cfg.Kafka)
+	if err != nil {
+		fmt.Printf("Error reading published events: %v\n", err)
+		os.Exit(2)
+	}
+
+	stored, err := fetchStoredFileIds(ctx, cfg.MongoDB)
+	if err != nil {
+		fmt.Printf("Error reading stored files: %v\n", err)
+		os.Exit(2)
+	}
+
+	duplicates, losses := 0, 0
+	for fileId, count := range published {
+		if count > 1 {
+			duplicates++
+			fmt.Printf("Duplicate: %s published %d times\n", fileId, count)
+		}
+	}
+	for _, fileId := range stored {
+		if published[fileId] == 0 {
+			losses++
+			fmt.Printf("Lost: %s was stored but never published\n", fileId)
+		}
+	}
+
+	fmt.Printf("Stored files: %d, published files: %d, duplicates: %d, losses: %d\n", len(stored), len(published), duplicates, losses)
+	if len(stored) == 0 {
+		fmt.Println("No stored files, the producer did not store anything")
+		os.Exit(1)
+	}
+	if duplicates > 0 || losses > 0 {
+		os.Exit(1)
+	}
+}
+
+func countPublishedEvents(ctx context.Context, kafka config.Kafka) (map[string]int, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	consumer, err := sarama.NewConsumer(kafka.Brokers, saramaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(kafka.Topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch partitions of topic %s: %w", kafka.Topic, err)
+	}
+
+	published := make(map[string]int)
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(kafka.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to consume partition %d: %w", partition, err)
+		}
+
+		err = countPartition(ctx, partitionConsumer, published)
+		partitionConsumer.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return published, nil
+}
+
+// countPartition reads until no message arrives anymore, the high water mark can not be used
+// because transaction markers and aborted messages are never delivered
+func countPartition(ctx context.Context, partitionConsumer sarama.PartitionConsumer, published map[string]int) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(idleTimeout):
+			return nil
+		case message := <-partitionConsumer.Messages():
+			if !isFileStored(message) {
+				continue
+			}
+			fileStored := &api.FileStored{}
+			if err := proto.Unmarshal(message.Value, fileStored); err != nil {
+				return fmt.Errorf("failed to unmarshal message at offset %d: %w", message.Offset, err)
+			}
+			published[fileStored.GetFileId()]++
+		}
+	}
+}
+
+// isFileStored also accepts messages without event type, they were published before the miner set headers
+func isFileStored(message *sarama.ConsumerMessage) bool {
+	eventType := metadata.HeaderValue(message.Headers, metadata.HeaderEventType)
+	return eventType == "" || eventType == fileStoredEventType
+}
+
+func fetchStoredFileIds(ctx context.Context, mongoDB config.MongoDB) ([]string, error) {
+	db, err := mongodb.Connect(ctx, mongoDB)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Disconnect()
+
+	collection := db.Database("store_file").Collection("file")
+	cursor, err := collection.Find(ctx, bson.M{"StoredAt": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored files: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var fileIds []string
+	for cursor.Next(ctx) {
+		_, fileIdData, ok := cursor.Current.Lookup("FileId").BinaryOK()
+		if !ok {
+			return nil, fmt.Errorf("FileId missing or not binary")
+		}
+		fileId, err := uuid.FromBytes(fileIdData)
+		if err != nil {
+			return nil, fmt.Errorf("FileId bytes could not be parsed as UUID: %w", err)
+		}
+		fileIds = append(fileIds, fileId.String())
+	}
+
+	return fileIds, cursor.Err()
+}
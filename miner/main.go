@@ -2,33 +2,89 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
 	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/miner/metadata"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/health"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	fmt.Println("Starting miner...")
+	cfg := metadata.DefaultConfig()
+	if err := config.Load("miner", os.Args[1:], &cfg); err != nil {
+		slog.Error("Error loading configuration", logging.Error(err))
+		os.Exit(2)
+	}
+	if err := logging.Setup("miner", cfg.Logging); err != nil {
+		slog.Error("Error setting up logging", logging.Error(err))
+		os.Exit(2)
+	}
+
+	slog.Info("Starting miner")
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, "miner", cfg.Tracing)
+	if err != nil {
+		slog.Error("Error setting up tracing", logging.Error(err))
+		return
+	}
+	defer shutdownTracing()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		slog.Error("Error connecting to MongoDB", logging.Error(err))
+		return
+	}
+	defer db.Disconnect()
+
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := metadata.MiningFileMetadata(ctx)
+		err := metadata.MiningFileMetadata(ctx, cfg, db)
 		if err != nil && !os.IsTimeout(err) && err != context.Canceled && err != context.DeadlineExceeded {
-			fmt.Printf("Error mining file metadata: %v\n", err)
+			slog.Error("Error mining file metadata", logging.Error(err))
+		}
+		// the status endpoint must not report a role of a miner that stopped
+		cancel()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := serveStatus(ctx, cfg, db)
+		if err != nil {
+			slog.Error("Error serving status", logging.Error(err))
 		}
 	}()
 
 	wg.Wait()
 
-	fmt.Println("Shutting down miner...")
+	slog.Info("Shutting down miner")
+}
+
+func serveStatus(ctx context.Context, cfg metadata.Config, db mongodb.Connection) error {
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.AddLivenessCheck("change-stream", metadata.ProgressCheck(cfg.Health.MaxProgressAge))
+	checker.AddReadinessCheck("mongodb", db.HealthCheck)
+	checker.AddReadinessCheck("kafka", health.KafkaCheck(cfg.Kafka.Brokers))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", metadata.StatusHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	checker.Register(mux)
+
+	return health.Serve(ctx, cfg.StatusAddress, mux)
 }
@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// Config of the miner, loaded with the shared config package.
+type Config struct {
+	Logging       config.Logging    `yaml:"logging"`
+	Tracing       config.Tracing    `yaml:"tracing"`
+	MongoDB       config.MongoDB    `yaml:"mongodb"`
+	Kafka         config.Kafka      `yaml:"kafka"`
+	StatusAddress string            `yaml:"statusAddress" env:"MINER_STATUS_ADDRESS" flag:"status-address" usage:"address of the status, metrics and health endpoints"`
+	Health        HealthConfig      `yaml:"health"`
+	WatcherName   string            `yaml:"watcherName" env:"MINER_WATCHER_NAME" flag:"watcher-name" usage:"name of the change stream in the shared resume token and lease"`
+	ResumeToken   ResumeTokenConfig `yaml:"resumeToken"`
+	Transactional TransactionConfig `yaml:"transactional"`
+	Leader        LeaderConfig      `yaml:"leaderElection"`
+	DeadLetter    DeadLetterConfig  `yaml:"deadLetter"`
+	Retry         RetryConfig       `yaml:"retry"`
+}
+
+type HealthConfig struct {
+	config.Health  `yaml:",inline"`
+	MaxProgressAge time.Duration `yaml:"maxProgressAge" env:"MINER_MAX_PROGRESS_AGE" flag:"max-progress-age" usage:"time without change event or empty batch until the miner is reported as not alive"`
+}
+
+type ResumeTokenConfig struct {
+	Storage   string `yaml:"storage" env:"MINER_RESUME_TOKEN_STORAGE" flag:"resume-token-storage" usage:"where the resume token is stored: file or mongodb"`
+	Directory string `yaml:"directory" env:"MINER_RESUME_TOKEN_DIRECTORY" flag:"resume-token-directory" usage:"directory of the resume token file"`
+	File      string `yaml:"file" env:"MINER_RESUME_TOKEN_FILE" flag:"resume-token-file" usage:"name of the resume token file"`
+	// IdleInterval keeps the resume token of a change stream without events close to the end of the oplog
+	IdleInterval time.Duration `yaml:"idleInterval" env:"MINER_RESUME_TOKEN_IDLE_INTERVAL" flag:"resume-token-idle-interval" usage:"interval the resume token is stored while no change leads to an event, zero disables it"`
+}
+
+type TransactionConfig struct {
+	Enabled          bool   `yaml:"enabled" env:"MINER_TRANSACTIONAL" flag:"transactional" usage:"publish the event and the resume token in one Kafka transaction"`
+	TransactionalId  string `yaml:"transactionalId" env:"MINER_TRANSACTIONAL_ID" flag:"transactional-id" usage:"transactional id of the Kafka producer"`
+	ResumeTokenTopic string `yaml:"resumeTokenTopic" env:"MINER_RESUME_TOKEN_TOPIC" flag:"resume-token-topic" usage:"compacted topic of the resume token"`
+}
+
+type LeaderConfig struct {
+	Enabled       bool          `yaml:"enabled" env:"MINER_LEADER_ELECTION" flag:"leader-election" usage:"tail the change stream only while this instance holds the lease"`
+	LeaseDuration time.Duration `yaml:"leaseDuration" env:"MINER_LEASE_DURATION" flag:"lease-duration" usage:"time until the lease of a dead leader expires"`
+	RenewInterval time.Duration `yaml:"renewInterval" env:"MINER_LEASE_RENEW_INTERVAL" flag:"lease-renew-interval" usage:"interval the leader renews its lease"`
+}
+
+type DeadLetterConfig struct {
+	Enabled           bool          `yaml:"enabled" env:"MINER_DEAD_LETTER" flag:"dead-letter" usage:"publish changes that can not be converted to the dead letter topic instead of stopping"`
+	Topic             string        `yaml:"topic" env:"MINER_DEAD_LETTER_TOPIC" flag:"dead-letter-topic" usage:"topic of the changes that can not be converted"`
+	ConversionRetries int           `yaml:"conversionRetries" env:"MINER_CONVERSION_RETRIES" flag:"conversion-retries" usage:"retries of a failed conversion before the change is dead lettered"`
+	RetryInterval     time.Duration `yaml:"retryInterval" env:"MINER_CONVERSION_RETRY_INTERVAL" flag:"conversion-retry-interval" usage:"wait between two conversion attempts"`
+}
+
+type RetryConfig struct {
+	InitialInterval     time.Duration `yaml:"initialInterval" env:"MINER_RETRY_INITIAL_INTERVAL" flag:"retry-initial-interval" usage:"wait before the first restart after a retryable error"`
+	MaxInterval         time.Duration `yaml:"maxInterval" env:"MINER_RETRY_MAX_INTERVAL" flag:"retry-max-interval" usage:"maximum wait between two restarts"`
+	Multiplier          float64       `yaml:"multiplier" env:"MINER_RETRY_MULTIPLIER" flag:"retry-multiplier" usage:"growth of the wait after each restart"`
+	RandomizationFactor float64       `yaml:"randomizationFactor" env:"MINER_RETRY_RANDOMIZATION_FACTOR" flag:"retry-randomization-factor" usage:"spread of the wait, 0.5 is +/-50%"`
+	MaxElapsedTime      time.Duration `yaml:"maxElapsedTime" env:"MINER_RETRY_MAX_ELAPSED_TIME" flag:"retry-max-elapsed-time" usage:"stop the miner when retryable errors last longer, 0 retries forever"`
+	ResetAfter          time.Duration `yaml:"resetAfter" env:"MINER_RETRY_RESET_AFTER" flag:"retry-reset-after" usage:"start the backoff from the beginning when the miner ran longer without failure"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Logging:       config.DefaultLogging(),
+		Tracing:       config.DefaultTracing(),
+		MongoDB:       config.DefaultMongoDB(),
+		Kafka:         config.DefaultKafka(),
+		StatusAddress: ":8081",
+		Health: HealthConfig{
+			Health:         config.DefaultHealth(),
+			MaxProgressAge: 2 * time.Minute,
+		},
+		WatcherName: "file-metadata",
+		ResumeToken: ResumeTokenConfig{
+			Storage:      ResumeTokenStorageFile,
+			Directory:    "app/data",
+			File:         "resume_token.bin",
+			IdleInterval: time.Minute,
+		},
+		Transactional: TransactionConfig{
+			Enabled:          false,
+			TransactionalId:  "miner-file-metadata",
+			ResumeTokenTopic: "file-stored-resume-token",
+		},
+		Leader: LeaderConfig{
+			Enabled:       false,
+			LeaseDuration: 15 * time.Second,
+			RenewInterval: 5 * time.Second,
+		},
+		DeadLetter: DeadLetterConfig{
+			Enabled:           true,
+			Topic:             "file-stored-dead-letter",
+			ConversionRetries: 3,
+			RetryInterval:     time.Second,
+		},
+		Retry: RetryConfig{
+			InitialInterval:     500 * time.Millisecond,
+			MaxInterval:         30 * time.Second,
+			Multiplier:          2,
+			RandomizationFactor: 0.5,
+			MaxElapsedTime:      5 * time.Minute,
+			ResetAfter:          time.Minute,
+		},
+	}
+}
+
+func (c *Config) Validate() error {
+	errs := []error{
+		c.MongoDB.Validate(),
+		c.Kafka.Validate(),
+		c.Health.Validate(),
+		c.Logging.Validate(),
+		c.Tracing.Validate(),
+	}
+
+	if c.WatcherName == "" {
+		errs = append(errs, errors.New("watcher name is required"))
+	}
+	switch c.ResumeToken.Storage {
+	case ResumeTokenStorageFile:
+		if c.ResumeToken.Directory == "" || c.ResumeToken.File == "" {
+			errs = append(errs, errors.New("resume token directory and file are required for storage file"))
+		}
+	case ResumeTokenStorageMongoDB:
+	default:
+		errs = append(errs, fmt.Errorf("resume token storage %q is not supported", c.ResumeToken.Storage))
+	}
+	if c.ResumeToken.IdleInterval < 0 {
+		errs = append(errs, errors.New("resume token idle interval must not be negative"))
+	}
+	if c.Transactional.Enabled && (c.Transactional.TransactionalId == "" || c.Transactional.ResumeTokenTopic == "") {
+		errs = append(errs, errors.New("transactional id and resume token topic are required for transactional publishing"))
+	}
+	if c.Leader.Enabled {
+		if c.ResumeToken.Storage == ResumeTokenStorageFile && !c.Transactional.Enabled {
+			errs = append(errs, errors.New("leader election requires a resume token storage that is shared by all replicas"))
+		}
+		if c.Leader.RenewInterval <= 0 || c.Leader.RenewInterval*2 > c.Leader.LeaseDuration {
+			errs = append(errs, errors.New("lease renew interval must be greater than zero and at most half of the lease duration"))
+		}
+	}
+	if c.DeadLetter.Enabled && c.DeadLetter.Topic == "" {
+		errs = append(errs, errors.New("dead letter topic is required"))
+	}
+	if c.DeadLetter.ConversionRetries < 0 {
+		errs = append(errs, errors.New("conversion retries must not be negative"))
+	}
+	errs = append(errs,
+		config.Positive("retry initial interval", c.Retry.InitialInterval),
+		config.Positive("retry max interval", c.Retry.MaxInterval),
+		config.Positive("retry multiplier", c.Retry.Multiplier),
+	)
+	if maxWait := time.Duration(float64(c.Retry.MaxInterval) * (1 + c.Retry.RandomizationFactor)); c.Health.MaxProgressAge <= maxWait {
+		// a miner waiting for its next restart must not be reported as stuck
+		errs = append(errs, fmt.Errorf("max progress age must be greater than the longest wait between two restarts of %s", maxWait))
+	}
+	if c.Retry.RandomizationFactor < 0 || c.Retry.RandomizationFactor > 1 {
+		errs = append(errs, errors.New("retry randomization factor must be between 0 and 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// resumeTokenStorage is the label of the resume token metrics, with transactional publishing the resume token is stored in Kafka.
+func (c Config) resumeTokenStorage() string {
+	if c.Transactional.Enabled {
+		return "kafka"
+	}
+
+	return c.ResumeToken.Storage
+}
+
+// Policy returns the retry policy that is applied when tailing the change stream or publishing fails.
+func (c RetryConfig) Policy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval:     c.InitialInterval,
+		MaxInterval:         c.MaxInterval,
+		Multiplier:          c.Multiplier,
+		RandomizationFactor: c.RandomizationFactor,
+		MaxElapsedTime:      c.MaxElapsedTime,
+		ResetAfter:          c.ResetAfter,
+	}
+}
@@ -0,0 +1,40 @@
+package metadata
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strconv"
+)
+
+const (
+	CrashPointAfterPublish = "after-publish"
+	CrashPointBeforeCommit = "before-commit"
+	// CrashExitCode is used by the harness to distinguish an injected crash from a real failure
+	CrashExitCode = 3
+)
+
+var (
+	// CrashPoint kills the miner at the given step, used by scripts/harness to verify the delivery guarantees
+	CrashPoint = os.Getenv("MINER_CRASH_POINT")
+	// CrashProbability is the chance to crash each time the crash point is reached, otherwise the miner would never make progress
+	CrashProbability = parseCrashProbability(os.Getenv("MINER_CRASH_PROBABILITY"))
+)
+
+func crashAt(point string) {
+	if CrashPoint != point || rand.Float64() >= CrashProbability {
+		return
+	}
+
+	slog.Warn("Crashing", "crash_point", point)
+	os.Exit(CrashExitCode)
+}
+
+func parseCrashProbability(value string) float64 {
+	probability, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0.2
+	}
+
+	return probability
+}
@@ -2,7 +2,11 @@ package metadata
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
+	"time"
 
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
 	"github.com/google/uuid"
 	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
 	"go.mongodb.org/mongo-driver/bson"
@@ -10,57 +14,183 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// CreateFileStoredEvent creates the event from the fullDocument of an insert, replace or update change event.
 func CreateFileStoredEvent(change bson.M) (*api.FileStored, error) {
-	// remarks: this works only for our scenario, where we have only update events with fullDocument configured
-	if fullDoc, ok := change["fullDocument"].(bson.M); ok {
-		fmt.Printf("Full document: %v\n", fullDoc)
-		fileStoredEvent := &api.FileStored{}
-
-		fileIdBin, ok := fullDoc["FileId"].(primitive.Binary)
-		if !ok || fileIdBin.Subtype != 4 || len(fileIdBin.Data) != 16 {
-			return nil, fmt.Errorf("FileId missing or not a valid UUID binary")
-		}
-		u, err := uuid.FromBytes(fileIdBin.Data)
-		if err != nil {
-			return nil, fmt.Errorf("FileId bytes could not be parsed as UUID: %w", err)
-		}
-		fileStoredEvent.SetFileId(u.String())
+	fullDoc, ok := change["fullDocument"].(bson.M)
+	if !ok {
+		return nil, conversionFailed(reasonMissingFullDocument, fmt.Errorf("fullDocument missing, the change stream must be configured with fullDocument"))
+	}
 
-		createdAt, ok := fullDoc["CreatedAt"].(primitive.DateTime)
-		if !ok {
-			return nil, fmt.Errorf("CreatedAt missing or not a primitive.DateTime")
-		}
-		fileStoredEvent.SetCreatedAt(timestamppb.New(createdAt.Time()))
+	fileStoredEvent := &api.FileStored{}
 
-		storedAt, ok := fullDoc["StoredAt"].(primitive.DateTime)
-		if !ok {
-			return nil, fmt.Errorf("StoredAt missing or not a primitive.DateTime")
-		}
-		fileStoredEvent.SetStoredAt(timestamppb.New(storedAt.Time()))
+	fileId, err := readFileId(fullDoc)
+	if err != nil {
+		return nil, err
+	}
+	fileStoredEvent.SetFileId(fileId)
 
-		size, ok := fullDoc["Size"].(int64)
-		if !ok {
-			return nil, fmt.Errorf("Size missing or not an int64")
-		}
-		fileStoredEvent.SetSize(size)
+	createdAt, ok := fullDoc["CreatedAt"].(primitive.DateTime)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("CreatedAt missing or not a primitive.DateTime"))
+	}
+	fileStoredEvent.SetCreatedAt(timestamppb.New(createdAt.Time()))
 
-		mediaType, ok := fullDoc["MediaType"].(string)
-		if !ok {
-			return nil, fmt.Errorf("MediaType missing or not a string")
-		}
-		fileStoredEvent.SetMediaType(mediaType)
+	storedAt, ok := fullDoc["StoredAt"].(primitive.DateTime)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("StoredAt missing or not a primitive.DateTime"))
+	}
+	fileStoredEvent.SetStoredAt(timestamppb.New(storedAt.Time()))
+
+	size, ok := fullDoc["Size"].(int64)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("Size missing or not an int64"))
+	}
+	fileStoredEvent.SetSize(size)
+
+	mediaType, ok := fullDoc["MediaType"].(string)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("MediaType missing or not a string"))
+	}
+	fileStoredEvent.SetMediaType(mediaType)
+
+	extension, ok := fullDoc["Extension"].(string)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("Extension missing or not a string"))
+	}
+	fileStoredEvent.SetExtension(extension)
 
-		extension, ok := fullDoc["Extension"].(string)
-		if !ok {
-			return nil, fmt.Errorf("Extension missing or not a string")
+	checksum, err := readChecksum(fullDoc)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != nil {
+		fileStoredEvent.SetChecksum(checksum)
+	}
+
+	slog.Info("FileStored event created", logging.KeyFileId, fileId, logging.Document(fileStoredEvent))
+
+	return fileStoredEvent, nil
+}
+
+// CreateFileDeletedEvent creates the event from the pre-image of a delete change event of a stored file.
+func CreateFileDeletedEvent(change bson.M) (*api.FileDeleted, error) {
+	preImage, err := readPreImage(change)
+	if err != nil {
+		return nil, err
+	}
+
+	fileDeletedEvent := &api.FileDeleted{}
+
+	fileId, err := readFileId(preImage)
+	if err != nil {
+		return nil, err
+	}
+	fileDeletedEvent.SetFileId(fileId)
+
+	deletedAt, err := readChangeTime(change)
+	if err != nil {
+		return nil, err
+	}
+	fileDeletedEvent.SetDeletedAt(timestamppb.New(deletedAt))
+
+	slog.Info("FileDeleted event created", logging.KeyFileId, fileId, logging.Document(fileDeletedEvent))
+
+	return fileDeletedEvent, nil
+}
+
+// CreateFileCleanedEvent creates the event from the pre-image of a delete change event of an incomplete upload.
+func CreateFileCleanedEvent(change bson.M) (*api.FileCleaned, error) {
+	preImage, err := readPreImage(change)
+	if err != nil {
+		return nil, err
+	}
+
+	fileCleanedEvent := &api.FileCleaned{}
+
+	fileId, err := readFileId(preImage)
+	if err != nil {
+		return nil, err
+	}
+	fileCleanedEvent.SetFileId(fileId)
+
+	createdAt, ok := preImage["CreatedAt"].(primitive.DateTime)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("CreatedAt missing or not a primitive.DateTime"))
+	}
+	fileCleanedEvent.SetCreatedAt(timestamppb.New(createdAt.Time()))
+
+	cleanedAt, err := readChangeTime(change)
+	if err != nil {
+		return nil, err
+	}
+	fileCleanedEvent.SetCleanedAt(timestamppb.New(cleanedAt))
+
+	slog.Info("FileCleaned event created", logging.KeyFileId, fileId, logging.Document(fileCleanedEvent))
+
+	return fileCleanedEvent, nil
+}
+
+func readPreImage(change bson.M) (bson.M, error) {
+	preImage, ok := change["fullDocumentBeforeChange"].(bson.M)
+	if !ok {
+		return nil, conversionFailed(reasonMissingPreImage, fmt.Errorf("fullDocumentBeforeChange missing, pre-images must be enabled on the collection"))
+	}
+
+	return preImage, nil
+}
+
+func readFileId(document bson.M) (string, error) {
+	fileIdBin, ok := document["FileId"].(primitive.Binary)
+	if !ok || fileIdBin.Subtype != 4 || len(fileIdBin.Data) != 16 {
+		return "", conversionFailed(reasonInvalidField, fmt.Errorf("FileId missing or not a valid UUID binary"))
+	}
+	u, err := uuid.FromBytes(fileIdBin.Data)
+	if err != nil {
+		return "", conversionFailed(reasonInvalidField, fmt.Errorf("FileId bytes could not be parsed as UUID: %w", err))
+	}
+
+	return u.String(), nil
+}
+
+// readChecksum returns nil for files that were stored before the producer computed a checksum.
+func readChecksum(document bson.M) (*api.Checksum, error) {
+	value, exists := document["Checksum"]
+	if !exists {
+		return nil, nil
+	}
+	stored, ok := value.(bson.M)
+	if !ok {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("Checksum is not a document"))
+	}
+
+	sha256, ok := stored["SHA256"].(primitive.Binary)
+	if !ok || len(sha256.Data) != 32 {
+		return nil, conversionFailed(reasonInvalidField, fmt.Errorf("Checksum.SHA256 missing or not a SHA-256 binary"))
+	}
+	checksum := &api.Checksum{}
+	checksum.SetSha256(sha256.Data)
+
+	if crc32c, exists := stored["CRC32C"]; exists {
+		crc, ok := crc32c.(int64)
+		if !ok || crc < 0 || crc > math.MaxUint32 {
+			return nil, conversionFailed(reasonInvalidField, fmt.Errorf("Checksum.CRC32C is not an unsigned 32 bit integer"))
 		}
-		fileStoredEvent.SetExtension(extension)
+		checksum.SetCrc32C(uint32(crc))
+	}
 
-		fmt.Printf("FileStored event: %+v\n", fileStoredEvent)
+	return checksum, nil
+}
 
-		return fileStoredEvent, nil
+// readChangeTime returns the wall time of the change event, MongoDB before 6.0 only provides the cluster time
+func readChangeTime(change bson.M) (time.Time, error) {
+	if wallTime, ok := change["wallTime"].(primitive.DateTime); ok {
+		return wallTime.Time(), nil
 	}
 
-	return nil, fmt.Errorf("Scenario not supported, only events with fullDocument configured are currently supported")
+	clusterTime, ok := change["clusterTime"].(primitive.Timestamp)
+	if !ok {
+		return time.Time{}, conversionFailed(reasonMissingChangeTime, fmt.Errorf("wallTime and clusterTime missing"))
+	}
 
+	return time.Unix(int64(clusterTime.T), 0).UTC(), nil
 }
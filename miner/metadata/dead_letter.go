@@ -0,0 +1,173 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/proto"
+)
+
+// Record headers of a dead letter in addition to the headers of the event
+const (
+	// HeaderErrorReason is the error of the last conversion attempt
+	HeaderErrorReason = "error-reason"
+	// HeaderFailedAt is the time of the last conversion attempt in RFC 3339
+	HeaderFailedAt = "failed-at"
+	// HeaderAttempts is the number of conversion attempts
+	HeaderAttempts = "attempts"
+)
+
+// DeadLetterReadIdleTimeout ends reading the dead letter topic when no further message arrives
+var DeadLetterReadIdleTimeout = 5 * time.Second
+
+// DeadLetter is a change that could not be converted into an event.
+type DeadLetter struct {
+	Partition int32
+	Offset    int64
+	Reason    string
+	FailedAt  string
+	Attempts  string
+	// CorrelationId is reused when the dead letter is redriven
+	CorrelationId string
+	// Change is the change event as canonical extended JSON
+	Change string
+}
+
+// CreateEventWithRetries retries the conversion ConversionRetries times before it returns the last error.
+func (c DeadLetterConfig) CreateEventWithRetries(ctx context.Context, change bson.M) (proto.Message, error) {
+	var err error
+	for attempt := 0; attempt <= c.ConversionRetries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("Retrying conversion of change", "attempt", attempt, "retries", c.ConversionRetries, logging.Error(err))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.RetryInterval):
+			}
+		}
+
+		var event proto.Message
+		event, err = CreateEvent(change)
+		if err == nil {
+			return event, nil
+		}
+	}
+
+	return nil, err
+}
+
+// createDeadLetterMessage creates the message of the dead letter topic, it contains the change event as canonical extended JSON.
+func (c DeadLetterConfig) createDeadLetterMessage(change bson.M, reason error, metadata EventMetadata) (*sarama.ProducerMessage, error) {
+	changeJson, err := bson.MarshalExtJSON(change, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal change as extended JSON: %w", err)
+	}
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(HeaderSource), Value: []byte(Source)},
+		{Key: []byte(HeaderClusterTime), Value: []byte(formatClusterTime(metadata.ClusterTime))},
+		{Key: []byte(HeaderCorrelationId), Value: []byte(metadata.CorrelationId)},
+		{Key: []byte(HeaderErrorReason), Value: []byte(reason.Error())},
+		{Key: []byte(HeaderFailedAt), Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(c.ConversionRetries + 1))},
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:   c.Topic,
+		Value:   sarama.ByteEncoder(changeJson),
+		Headers: headers,
+	}, nil
+}
+
+// ReadDeadLetters returns all dead letters from the beginning of the dead letter topic.
+func ReadDeadLetters(ctx context.Context, cfg Config) ([]DeadLetter, error) {
+	deadLetterTopic := cfg.DeadLetter.Topic
+	config := sarama.NewConfig()
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	consumer, err := sarama.NewConsumer(cfg.Kafka.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(deadLetterTopic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch partitions of topic %s: %w", deadLetterTopic, err)
+	}
+
+	var deadLetters []DeadLetter
+	for _, partition := range partitions {
+		partitionConsumer, err := consumer.ConsumePartition(deadLetterTopic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to consume partition %d of topic %s: %w", partition, deadLetterTopic, err)
+		}
+
+		deadLetters, err = readDeadLetterPartition(ctx, partitionConsumer, deadLetters)
+		partitionConsumer.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deadLetters, nil
+}
+
+func readDeadLetterPartition(ctx context.Context, partitionConsumer sarama.PartitionConsumer, deadLetters []DeadLetter) ([]DeadLetter, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(DeadLetterReadIdleTimeout):
+			return deadLetters, nil
+		case message := <-partitionConsumer.Messages():
+			deadLetters = append(deadLetters, DeadLetter{
+				Partition:     message.Partition,
+				Offset:        message.Offset,
+				Reason:        HeaderValue(message.Headers, HeaderErrorReason),
+				FailedAt:      HeaderValue(message.Headers, HeaderFailedAt),
+				Attempts:      HeaderValue(message.Headers, HeaderAttempts),
+				CorrelationId: HeaderValue(message.Headers, HeaderCorrelationId),
+				Change:        string(message.Value),
+			})
+		}
+	}
+}
+
+// RedriveDeadLetter converts the change again and publishes the event, e.g. after the conversion was fixed.
+// The resume token is not touched, the change stream already continued after the dead letter. The publisher must be created
+// with NewRedrivePublisher, the message is sent outside of a transaction.
+func (p *Publisher) RedriveDeadLetter(deadLetter DeadLetter) error {
+	var change bson.M
+	if err := bson.UnmarshalExtJSON([]byte(deadLetter.Change), true, &change); err != nil {
+		return fmt.Errorf("failed to unmarshal change from extended JSON: %w", err)
+	}
+
+	event, err := CreateEvent(change)
+	if err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+	if event == nil {
+		slog.Info("Change does not lead to an event", "operation_type", change["operationType"])
+		return nil
+	}
+
+	metadata := EventMetadata{CorrelationId: deadLetter.CorrelationId}
+	if clusterTime, ok := change["clusterTime"].(primitive.Timestamp); ok {
+		metadata.ClusterTime = clusterTime
+	}
+	if changeId, ok := change["_id"].(bson.M); ok {
+		if resumeToken, err := bson.Marshal(changeId); err == nil {
+			metadata.ResumeToken = resumeToken
+		}
+	}
+
+	return p.PublishEvent(event, metadata)
+}
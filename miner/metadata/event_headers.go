@@ -0,0 +1,82 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/proto"
+)
+
+// Record headers of every published event, consumers dispatch on HeaderEventType without decoding the value
+const (
+	// HeaderEventType is the fully qualified protobuf name, e.g. 'store_file.v1.FileStored'
+	HeaderEventType = "event-type"
+	// HeaderSchemaVersion is the version of the protobuf package, e.g. 'v1'
+	HeaderSchemaVersion = "schema-version"
+	// HeaderSource is the service that published the event
+	HeaderSource = "source"
+	// HeaderClusterTime is the cluster time of the change event as '<seconds>.<increment>'
+	HeaderClusterTime = "cluster-time"
+	// HeaderResumeTokenHash is the hex encoded SHA-256 of the resume token of the change event
+	HeaderResumeTokenHash = "resume-token-hash"
+	// HeaderCorrelationId is unique per published event
+	HeaderCorrelationId = "correlation-id"
+	// HeaderSnapshot is 'true' for events created from a snapshot of the collection instead of a change event
+	HeaderSnapshot = "snapshot"
+)
+
+const Source = "miner"
+
+// HeaderValue returns the value of the header with the key, or an empty string if there is no such header.
+// It accepts the headers of a produced and of a consumed message.
+func HeaderValue[H sarama.RecordHeader | *sarama.RecordHeader](headers []H, key string) string {
+	for _, header := range headers {
+		var recordHeader *sarama.RecordHeader
+		switch h := any(header).(type) {
+		case sarama.RecordHeader:
+			recordHeader = &h
+		case *sarama.RecordHeader:
+			recordHeader = h
+		}
+		if recordHeader != nil && string(recordHeader.Key) == key {
+			return string(recordHeader.Value)
+		}
+	}
+
+	return ""
+}
+
+// EventMetadata describes the change event an event was created from.
+type EventMetadata struct {
+	ClusterTime   primitive.Timestamp
+	ResumeToken   bson.Raw
+	CorrelationId string
+}
+
+func createEventHeaders(event proto.Message, metadata EventMetadata) []sarama.RecordHeader {
+	descriptor := event.ProtoReflect().Descriptor()
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(HeaderEventType), Value: []byte(descriptor.FullName())},
+		{Key: []byte(HeaderSchemaVersion), Value: []byte(descriptor.ParentFile().Package().Name())},
+		{Key: []byte(HeaderSource), Value: []byte(Source)},
+		{Key: []byte(HeaderClusterTime), Value: []byte(formatClusterTime(metadata.ClusterTime))},
+		{Key: []byte(HeaderCorrelationId), Value: []byte(metadata.CorrelationId)},
+	}
+	// events of a snapshot do not have a change event
+	if metadata.ResumeToken != nil {
+		resumeTokenHash := sha256.Sum256(metadata.ResumeToken)
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderResumeTokenHash), Value: []byte(hex.EncodeToString(resumeTokenHash[:]))})
+	}
+
+	return headers
+}
+
+// formatClusterTime formats the cluster time as seconds.increment like the mongo shell does.
+func formatClusterTime(clusterTime primitive.Timestamp) string {
+	return fmt.Sprintf("%d.%d", clusterTime.T, clusterTime.I)
+}
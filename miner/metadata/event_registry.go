@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/protobuf/proto"
+)
+
+// EventBuilder creates the event of a change event. It returns nil if the change event does not lead to an event.
+type EventBuilder func(change bson.M) (proto.Message, error)
+
+// eventBuilders maps the operation type of the change event to its builder
+var eventBuilders = map[string]EventBuilder{
+	"insert":  buildFileStoredEvent,
+	"update":  buildFileStoredEvent,
+	"replace": buildFileStoredEventOnReplace,
+	"delete":  buildDeleteEvent,
+}
+
+// RegisterEventBuilder adds or replaces the builder of an operation type.
+// The change stream pipeline must let the change events of the operation type pass.
+func RegisterEventBuilder(operationType string, builder EventBuilder) {
+	eventBuilders[operationType] = builder
+}
+
+func CreateEvent(change bson.M) (proto.Message, error) {
+	operationType, ok := change["operationType"].(string)
+	if !ok {
+		return nil, conversionFailed(reasonMissingOperationType, fmt.Errorf("operationType missing or not a string"))
+	}
+
+	builder, ok := eventBuilders[operationType]
+	if !ok {
+		return nil, conversionFailed(reasonUnsupportedOperationType, fmt.Errorf("operation type %s is not supported", operationType))
+	}
+
+	return builder(change)
+}
+
+func buildFileStoredEvent(change bson.M) (proto.Message, error) {
+	event, err := CreateFileStoredEvent(change)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// buildFileStoredEventOnReplace announces the file only when the replacement completes the upload.
+// Without pre-image the file is announced again, consumers have to tolerate that.
+func buildFileStoredEventOnReplace(change bson.M) (proto.Message, error) {
+	if preImage, ok := change["fullDocumentBeforeChange"].(bson.M); ok {
+		if _, stored := preImage["StoredAt"]; stored {
+			return nil, nil
+		}
+	}
+
+	return buildFileStoredEvent(change)
+}
+
+// buildDeleteEvent distinguishes a stored file deleted by a user from an incomplete upload removed by the cleaner.
+// Only the cleaner deletes documents without StoredAt.
+func buildDeleteEvent(change bson.M) (proto.Message, error) {
+	preImage, err := readPreImage(change)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, stored := preImage["StoredAt"]; !stored {
+		event, err := CreateFileCleanedEvent(change)
+		if err != nil {
+			return nil, err
+		}
+		return event, nil
+	}
+
+	event, err := CreateFileDeletedEvent(change)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
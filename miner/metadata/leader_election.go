@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+type Role string
+
+const (
+	RoleStandalone Role = "standalone"
+	RoleLeader     Role = "leader"
+	RoleFollower   Role = "follower"
+)
+
+var (
+	InstanceId  = createInstanceId()
+	currentRole atomic.Value
+)
+
+func init() {
+	currentRole.Store(RoleStandalone)
+}
+
+// CurrentRole returns whether this miner instance tails the change stream right now.
+func CurrentRole() Role {
+	return currentRole.Load().(Role)
+}
+
+func setRole(role Role) {
+	if currentRole.Swap(role) != role {
+		slog.Info("Miner changed its role", "instance_id", InstanceId, "role", role)
+	}
+}
+
+// LeaderElector holds a lease document in MongoDB while it leads. The lease expires after the lease duration
+// when the leader dies, afterwards one of the followers acquires it.
+// The expiry is evaluated with the clock of the MongoDB server, so the clocks of the miners do not need to be in sync.
+type LeaderElector struct {
+	collection    *mongo.Collection
+	leaseName     string
+	instanceId    string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+}
+
+func NewLeaderElector(database *mongo.Database, collectionName string, leaseName string, instanceId string, leaseDuration time.Duration, renewInterval time.Duration) *LeaderElector {
+	collectionOptions := options.Collection().SetWriteConcern(writeconcern.Majority())
+
+	return &LeaderElector{
+		collection:    database.Collection(collectionName, collectionOptions),
+		leaseName:     leaseName,
+		instanceId:    instanceId,
+		leaseDuration: leaseDuration,
+		renewInterval: renewInterval,
+	}
+}
+
+// EnsureLeaseIndex removes expired leases of miners that never came back.
+func (e *LeaderElector) EnsureLeaseIndex(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "ExpiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := e.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to create lease index: %w", err)
+	}
+
+	return nil
+}
+
+// Run calls lead as long as this instance holds the lease. The context of lead is cancelled when the lease is lost.
+// Run returns when ctx is cancelled or lead returns.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context) error) error {
+	setRole(RoleFollower)
+
+	for {
+		requested := time.Now()
+		acquired, err := e.tryAcquireOrRenew(ctx)
+		if err != nil {
+			slog.Warn("Failed to acquire lease", "lease", e.leaseName, logging.Error(err))
+		}
+
+		if acquired {
+			err := e.lead(ctx, requested.Add(e.leaseDuration), lead)
+			if err != nil || ctx.Err() != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.renewInterval):
+		}
+	}
+}
+
+// lead renews the lease until lead returns or the lease is lost. It returns nil if only the lease was lost.
+// expiresAt is measured from before the request that acquired or renewed the lease, so it is never later than the expiry on the server.
+// A failed renewal is repeated at the next interval as long as the lease is valid for longer than the safety margin,
+// the leader steps down when another instance holds the lease or the lease is about to expire.
+func (e *LeaderElector) lead(ctx context.Context, expiresAt time.Time, lead func(ctx context.Context) error) error {
+	setRole(RoleLeader)
+	defer setRole(RoleFollower)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lead(leaderCtx)
+	}()
+
+	for {
+		stepDownAt := expiresAt.Add(-e.safetyMargin())
+		// a retry after a failed renewal must not wait beyond the safety margin
+		wait := min(e.renewInterval, time.Until(stepDownAt))
+		select {
+		case err := <-done:
+			e.release()
+			return err
+		case <-time.After(wait):
+			requested := time.Now()
+			renewed, err := e.renewBefore(ctx, stepDownAt)
+			switch {
+			case renewed:
+				expiresAt = requested.Add(e.leaseDuration)
+				continue
+			case err == nil:
+				slog.Warn("Lease is held by another instance, stepping down", "lease", e.leaseName)
+			case time.Now().Before(stepDownAt):
+				slog.Warn("Failed to renew lease, keep leading", "lease", e.leaseName, "expires_at", expiresAt, logging.Error(err))
+				continue
+			default:
+				slog.Warn("Failed to renew lease before it expires, stepping down", "lease", e.leaseName, logging.Error(err))
+			}
+
+			// stop immediately, a follower takes over as soon as the lease expires
+			cancel()
+			<-done
+			return nil
+		}
+	}
+}
+
+// safetyMargin is the time the leader has to stop tailing before its lease expires.
+func (e *LeaderElector) safetyMargin() time.Duration {
+	return e.leaseDuration / 5
+}
+
+// renewBefore gives up the renewal at the deadline, so that a hanging request does not keep the leader beyond its lease.
+func (e *LeaderElector) renewBefore(ctx context.Context, deadline time.Time) (bool, error) {
+	renewCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	return e.tryAcquireOrRenew(renewCtx)
+}
+
+// tryAcquireOrRenew extends the lease if this instance holds it or the lease expired.
+func (e *LeaderElector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	renewCtx, cancel := context.WithTimeout(ctx, e.renewInterval)
+	defer cancel()
+
+	filter := bson.M{
+		"_id": e.leaseName,
+		"$or": bson.A{
+			bson.M{"Holder": e.instanceId},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$ExpiresAt", "$$NOW"}}},
+		},
+	}
+	update := mongo.Pipeline{
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "Holder", Value: e.instanceId},
+			{Key: "RenewedAt", Value: "$$NOW"},
+			{Key: "ExpiresAt", Value: bson.M{"$add": bson.A{"$$NOW", e.leaseDuration.Milliseconds()}}},
+		}}},
+	}
+
+	result, err := e.collection.UpdateOne(renewCtx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// the lease exists and is held by another instance
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return result.MatchedCount == 1 || result.UpsertedCount == 1, nil
+}
+
+// release deletes the lease, so that a follower does not have to wait until it expires
+func (e *LeaderElector) release() {
+	releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := e.collection.DeleteOne(releaseCtx, bson.M{"_id": e.leaseName, "Holder": e.instanceId})
+	if err != nil {
+		slog.Error("Failed to release lease", "lease", e.leaseName, logging.Error(err))
+		return
+	}
+
+	slog.Info("Released lease", "lease", e.leaseName)
+}
+
+func createInstanceId() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "miner"
+	}
+
+	return fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8])
+}
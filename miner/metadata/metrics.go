@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Metrics of the miner, exposed on /metrics of the status endpoint
+var (
+	changeEventsObserved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "miner",
+		Name:      "change_events_observed_total",
+		Help:      "Change events received from the change stream.",
+	}, []string{"operation_type"})
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "miner",
+		Name:      "events_published_total",
+		Help:      "Events published to Kafka, dead letters included.",
+	}, []string{"topic", "event_type"})
+	publishDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "miner",
+		Name:      "publish_duration_seconds",
+		Help:      "Duration of publishing an event, with transactional publishing including the commit of the resume token.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	conversionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "miner",
+		Name:      "conversion_failures_total",
+		Help:      "Failed attempts to convert a change event into an event.",
+	}, []string{"reason"})
+	resumeTokenWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "miner",
+		Name:      "resume_token_write_duration_seconds",
+		Help:      "Duration of storing the resume token outside of a Kafka transaction.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"storage"})
+	miningRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "miner",
+		Name:      "restarts_total",
+		Help:      "Restarts of the change stream after a retryable error.",
+	})
+	replicationLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "miner",
+		Name:      "replication_lag_seconds",
+		Help:      "Wall clock minus the cluster time of the last observed change event.",
+	})
+)
+
+// Reasons of a failed conversion, the label of conversionFailures
+const (
+	reasonMissingOperationType     = "missing_operation_type"
+	reasonUnsupportedOperationType = "unsupported_operation_type"
+	reasonMissingFullDocument      = "missing_full_document"
+	reasonMissingPreImage          = "missing_pre_image"
+	reasonMissingChangeTime        = "missing_change_time"
+	reasonInvalidField             = "invalid_field"
+)
+
+// conversionFailed counts the failure and returns err unchanged.
+func conversionFailed(reason string, err error) error {
+	conversionFailures.WithLabelValues(reason).Inc()
+	return err
+}
+
+func observeChangeEvent(operationType any, clusterTime primitive.Timestamp) {
+	operation, _ := operationType.(string)
+	changeEventsObserved.WithLabelValues(operation).Inc()
+
+	if clusterTime.T != 0 {
+		// the cluster time has a resolution of seconds
+		replicationLag.Set(time.Since(time.Unix(int64(clusterTime.T), 0)).Seconds())
+	}
+}
+
+// observePublished records the published events, the resume token is not an event.
+func observePublished(started time.Time, messages ...*sarama.ProducerMessage) {
+	publishDuration.Observe(time.Since(started).Seconds())
+
+	for _, message := range messages {
+		eventsPublished.WithLabelValues(message.Topic, HeaderValue(message.Headers, HeaderEventType)).Inc()
+	}
+}
+
+func observeResumeTokenWrite(started time.Time, storage string) {
+	resumeTokenWriteDuration.WithLabelValues(storage).Observe(time.Since(started).Seconds())
+}
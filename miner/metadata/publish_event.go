@@ -1,62 +1,151 @@
 package metadata
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"go.mongodb.org/mongo-driver/bson"
 	"google.golang.org/protobuf/proto"
 )
 
-var (
-	brokers  = []string{"localhost:9095"}
-	topic    = "file-stored"
+// EventKeyExtractor derives the message key of an event
+var EventKeyExtractor KeyExtractor = FileIdKey
+
+// Publisher publishes the events to the topic of the file events.
+type Publisher struct {
 	producer sarama.SyncProducer
-)
+	topic    string
+}
 
-func PublishEvent(event proto.Message) error {
-	fmt.Println("Publishing event...")
+// KeyExtractor returns the message key of an event.
+// Events with the same key are published to the same partition, consumers receive them in the order they were published.
+type KeyExtractor func(event proto.Message) (string, error)
 
-	msgBytes, err := proto.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal protobuf message: %w", err)
+// FileIdKey keys the event by its file id, so that all events of a file keep their order.
+func FileIdKey(event proto.Message) (string, error) {
+	eventWithFileId, ok := event.(interface{ GetFileId() string })
+	if !ok || eventWithFileId.GetFileId() == "" {
+		return "", fmt.Errorf("event %s has no file id", event.ProtoReflect().Descriptor().FullName())
 	}
 
-	kafkaMsg := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.ByteEncoder(msgBytes),
+	return eventWithFileId.GetFileId(), nil
+}
+
+func (p *Publisher) PublishEvent(event proto.Message, metadata EventMetadata) error {
+	kafkaMsg, err := p.createEventMessage(event, metadata)
+	if err != nil {
+		return err
 	}
 
-	partition, offset, err := producer.SendMessage(kafkaMsg)
+	return p.publishMessage(kafkaMsg)
+}
+
+func (p *Publisher) publishMessage(kafkaMsg *sarama.ProducerMessage) error {
+	started := time.Now()
+	partition, offset, err := p.producer.SendMessage(kafkaMsg)
 	if err != nil {
-		return fmt.Errorf("failed to publish event to Kafka: %w", err)
+		return fmt.Errorf("failed to publish message to Kafka: %w", err)
 	}
+	observePublished(started, kafkaMsg)
 
-	fmt.Printf("Event published to partition %d at offset %d\n", partition, offset)
+	slog.Info("Message published",
+		logging.KeyFileId, kafkaMsg.Key,
+		logging.KeyTopic, kafkaMsg.Topic,
+		logging.KeyPartition, partition,
+		logging.KeyOffset, offset,
+		logging.KeyCorrelationId, HeaderValue(kafkaMsg.Headers, HeaderCorrelationId))
 	return nil
 }
 
-func CreateEventProducer() error {
-	if producer == nil {
-		config := sarama.NewConfig()
-		config.Producer.Return.Successes = true
-
-		var err error
-		producer, err = sarama.NewSyncProducer(brokers, config)
+// publishAndStoreResumeToken publishes the message and stores the resume token afterwards.
+// With transactional publishing both are written in one transaction. A crash before the commit aborts both,
+// so the message is published again from the previous resume token.
+func (m *miner) publishAndStoreResumeToken(ctx context.Context, kafkaMsg *sarama.ProducerMessage, resumeToken bson.Raw) error {
+	if m.transaction != nil {
+		err := m.transaction.publishInTransaction(resumeToken, kafkaMsg)
 		if err != nil {
-			return fmt.Errorf("failed to create producer: %w", err)
+			return fmt.Errorf("failed to publish message and resume token: %w", err)
 		}
 
-		fmt.Println("Kafka producer created")
+		slog.Info("Message and resume token committed",
+			logging.KeyFileId, kafkaMsg.Key,
+			logging.KeyTopic, kafkaMsg.Topic,
+			logging.KeyCorrelationId, HeaderValue(kafkaMsg.Headers, HeaderCorrelationId),
+			logging.ResumeToken(resumeToken))
+		return nil
 	}
 
+	if err := m.publisher.publishMessage(kafkaMsg); err != nil {
+		return err
+	}
+
+	crashAt(CrashPointAfterPublish)
+
+	started := time.Now()
+	if err := m.resumeTokens.StoreResumeToken(ctx, resumeToken); err != nil {
+		return fmt.Errorf("failed to store resume token: %w", err)
+	}
+	observeResumeTokenWrite(started, m.cfg.resumeTokenStorage())
+
 	return nil
 }
 
-func CloseEventProducer() error {
-	if producer != nil {
-		if err := producer.Close(); err != nil {
-			return fmt.Errorf("Failed to close producer: %w\n", err)
-		}
+func (p *Publisher) createEventMessage(event proto.Message, metadata EventMetadata) (*sarama.ProducerMessage, error) {
+	msgBytes, err := proto.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal protobuf message: %w", err)
+	}
+
+	key, err := EventKeyExtractor(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract message key: %w", err)
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:   p.topic,
+		Key:     sarama.StringEncoder(key),
+		Value:   sarama.ByteEncoder(msgBytes),
+		Headers: createEventHeaders(event, metadata),
+	}, nil
+}
+
+// NewPublisher creates the producer of the file events. With transactional publishing the producer is transactional,
+// its transactional id must be stable across restarts, the broker fences older producers with the same id.
+func NewPublisher(cfg Config) (*Publisher, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	// the partition is derived from the hash of the message key, the same key always lands on the same partition
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	if cfg.Transactional.Enabled {
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Producer.Transaction.ID = cfg.Transactional.TransactionalId
+		config.Net.MaxOpenRequests = 1
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Kafka.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+
+	slog.Info("Kafka producer created", "transactional", cfg.Transactional.Enabled)
+	return &Publisher{producer: producer, topic: cfg.Kafka.Topic}, nil
+}
+
+// NewRedrivePublisher creates a producer that is never transactional. A producer with the transactional id of the miner
+// would fence the running miner, and RedriveDeadLetter publishes outside of a transaction.
+func NewRedrivePublisher(cfg Config) (*Publisher, error) {
+	cfg.Transactional.Enabled = false
+	return NewPublisher(cfg)
+}
+
+func (p *Publisher) Close() error {
+	if err := p.producer.Close(); err != nil {
+		return fmt.Errorf("Failed to close producer: %w\n", err)
 	}
 
 	return nil
@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	api "github.com/kinneko-de/sample-eventual-consistency-transaction-log-tailing-mongodb/golang/store_file/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testFileId = "4b4f6c3e-3b1a-4c8e-9f3a-2f1d0c9b8a7e"
+
+func newFileStored(fileId string) *api.FileStored {
+	event := &api.FileStored{}
+	event.SetFileId(fileId)
+	return event
+}
+
+func newFileDeleted(fileId string) *api.FileDeleted {
+	event := &api.FileDeleted{}
+	event.SetFileId(fileId)
+	return event
+}
+
+func newFileCleaned(fileId string) *api.FileCleaned {
+	event := &api.FileCleaned{}
+	event.SetFileId(fileId)
+	return event
+}
+
+func TestFileIdKey(t *testing.T) {
+	events := map[string]proto.Message{
+		"FileStored":  newFileStored(testFileId),
+		"FileDeleted": newFileDeleted(testFileId),
+		"FileCleaned": newFileCleaned(testFileId),
+	}
+
+	for name, event := range events {
+		t.Run(name, func(t *testing.T) {
+			key, err := FileIdKey(event)
+			if err != nil {
+				t.Fatalf("FileIdKey failed: %v", err)
+			}
+			if key != testFileId {
+				t.Fatalf("FileIdKey returned %q, want %q", key, testFileId)
+			}
+		})
+	}
+}
+
+func TestFileIdKeyFailsWithoutFileId(t *testing.T) {
+	events := map[string]proto.Message{
+		"empty file id":      newFileStored(""),
+		"event without file": timestamppb.Now(),
+	}
+
+	for name, event := range events {
+		t.Run(name, func(t *testing.T) {
+			if key, err := FileIdKey(event); err == nil {
+				t.Fatalf("FileIdKey returned %q, want an error", key)
+			}
+		})
+	}
+}
+
+func TestCreateEventMessageUsesEventKeyExtractor(t *testing.T) {
+	defer func(original KeyExtractor) { EventKeyExtractor = original }(EventKeyExtractor)
+	EventKeyExtractor = func(event proto.Message) (string, error) {
+		return "tenant-a", nil
+	}
+	publisher := &Publisher{topic: "file-stored"}
+
+	message, err := publisher.createEventMessage(newFileStored(testFileId), EventMetadata{})
+	if err != nil {
+		t.Fatalf("createEventMessage failed: %v", err)
+	}
+
+	if key := encodedKey(t, message); key != "tenant-a" {
+		t.Fatalf("message key is %q, want the key of the extractor", key)
+	}
+}
+
+func TestCreateEventMessageFailsWithoutKey(t *testing.T) {
+	publisher := &Publisher{topic: "file-stored"}
+
+	if _, err := publisher.createEventMessage(newFileStored(""), EventMetadata{}); err == nil {
+		t.Fatal("createEventMessage succeeded, want an error")
+	}
+}
+
+// The events of a file must keep their order, so the producer has to publish them to the same partition.
+func TestEventsOfFileArePublishedToSamePartition(t *testing.T) {
+	publisher := &Publisher{topic: "file-stored"}
+	partitioner := sarama.NewHashPartitioner("file-stored")
+	const numPartitions = 12
+
+	var partitions []int32
+	for _, event := range []proto.Message{newFileStored(testFileId), newFileDeleted(testFileId), newFileCleaned(testFileId)} {
+		message, err := publisher.createEventMessage(event, EventMetadata{})
+		if err != nil {
+			t.Fatalf("createEventMessage failed: %v", err)
+		}
+		partition, err := partitioner.Partition(message, numPartitions)
+		if err != nil {
+			t.Fatalf("Partition failed: %v", err)
+		}
+		partitions = append(partitions, partition)
+	}
+
+	for _, partition := range partitions[1:] {
+		if partition != partitions[0] {
+			t.Fatalf("events of one file were assigned to the partitions %v, want a single partition", partitions)
+		}
+	}
+}
+
+func encodedKey(t *testing.T, message *sarama.ProducerMessage) string {
+	t.Helper()
+
+	key, err := message.Key.Encode()
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	return string(key)
+}
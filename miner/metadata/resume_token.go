@@ -0,0 +1,15 @@
+package metadata
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ResumeTokenStore persists the resume token of the change stream, so that the miner continues where it stopped after a restart.
+type ResumeTokenStore interface {
+	// FetchResumeToken returns the last stored resume token or nil if no resume token was stored yet.
+	FetchResumeToken(ctx context.Context) (bson.Raw, error)
+	// StoreResumeToken replaces the last stored resume token.
+	StoreResumeToken(ctx context.Context, token bson.Raw) error
+}
@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FileResumeTokenStore stores the resume token as raw BSON in a local file.
+// The state is lost when the container is rescheduled, use MongoResumeTokenStore to run the miner stateless.
+type FileResumeTokenStore struct {
+	directory string
+	file      string
+}
+
+func NewFileResumeTokenStore(directory string, file string) *FileResumeTokenStore {
+	return &FileResumeTokenStore{
+		directory: directory,
+		file:      file,
+	}
+}
+
+func (s *FileResumeTokenStore) FetchResumeToken(ctx context.Context) (bson.Raw, error) {
+	data, err := os.ReadFile(s.filePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read resume token file: %w", err)
+	}
+
+	return bson.Raw(data), nil
+}
+
+// StoreResumeToken writes the resume token to a temporary file and renames it afterwards.
+// A crash during the write leaves the previous resume token untouched.
+func (s *FileResumeTokenStore) StoreResumeToken(ctx context.Context, token bson.Raw) error {
+	if err := os.MkdirAll(s.directory, 0755); err != nil {
+		return fmt.Errorf("failed to create resume token directory: %w", err)
+	}
+
+	tempFile, err := os.CreateTemp(s.directory, s.file+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary resume token file: %w", err)
+	}
+	tempFilePath := tempFile.Name()
+	// removing fails after a successful rename, which is fine
+	defer os.Remove(tempFilePath)
+
+	if _, err := tempFile.Write(token); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write temporary resume token file: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to sync temporary resume token file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary resume token file: %w", err)
+	}
+
+	if err := os.Rename(tempFilePath, s.filePath()); err != nil {
+		return fmt.Errorf("failed to replace resume token file: %w", err)
+	}
+
+	return syncDirectory(s.directory)
+}
+
+func (s *FileResumeTokenStore) filePath() string {
+	return filepath.Join(s.directory, s.file)
+}
+
+// syncDirectory persists the rename, otherwise the directory entry can still point to the old file after a power loss
+func syncDirectory(directory string) error {
+	if runtime.GOOS == "windows" {
+		// directories can not be synced on windows, the rename is already durable there
+		return nil
+	}
+
+	dir, err := os.Open(directory)
+	if err != nil {
+		return fmt.Errorf("failed to open resume token directory: %w", err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync resume token directory: %w", err)
+	}
+
+	return nil
+}
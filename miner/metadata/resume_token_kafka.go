@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ResumeTokenReadIdleTimeout ends reading the resume token topic when no further message arrives.
+// The commit marker of the last transaction is the last record of the topic and is never delivered to the consumer.
+var ResumeTokenReadIdleTimeout = 2 * time.Second
+
+// KafkaResumeTokenStore stores the resume token in a compacted Kafka topic keyed by the watcher name.
+// Together with a transactional producer the resume token is written in the same transaction as the event.
+type KafkaResumeTokenStore struct {
+	brokers     []string
+	topic       string
+	watcherName string
+	producer    sarama.SyncProducer
+	lastToken   bson.Raw
+}
+
+// NewKafkaResumeTokenStore writes with the transactional producer of the publisher.
+func NewKafkaResumeTokenStore(brokers []string, topic string, watcherName string, publisher *Publisher) *KafkaResumeTokenStore {
+	return &KafkaResumeTokenStore{
+		brokers:     brokers,
+		topic:       topic,
+		watcherName: watcherName,
+		producer:    publisher.producer,
+	}
+}
+
+// FetchResumeToken reads the committed resume tokens from the beginning of the topic and returns the last one of this watcher.
+// The topic is only read once, afterwards the resume token of the last committed transaction is returned.
+func (s *KafkaResumeTokenStore) FetchResumeToken(ctx context.Context) (bson.Raw, error) {
+	if s.lastToken != nil {
+		return s.lastToken, nil
+	}
+
+	config := sarama.NewConfig()
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	kafkaClient, err := sarama.NewClient(s.brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+	defer kafkaClient.Close()
+
+	endOffset, err := kafkaClient.GetOffset(s.topic, 0, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get end offset of topic %s: %w", s.topic, err)
+	}
+	startOffset, err := kafkaClient.GetOffset(s.topic, 0, sarama.OffsetOldest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get start offset of topic %s: %w", s.topic, err)
+	}
+	if startOffset >= endOffset {
+		return nil, nil
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(kafkaClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	partitionConsumer, err := consumer.ConsumePartition(s.topic, 0, startOffset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume topic %s: %w", s.topic, err)
+	}
+	defer partitionConsumer.Close()
+
+	var token bson.Raw
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ResumeTokenReadIdleTimeout):
+			s.lastToken = token
+			return token, nil
+		case message := <-partitionConsumer.Messages():
+			if string(message.Key) == s.watcherName {
+				token = bson.Raw(message.Value)
+			}
+			if message.Offset+1 >= endOffset {
+				s.lastToken = token
+				return token, nil
+			}
+		}
+	}
+}
+
+// StoreResumeToken writes only the resume token in its own transaction.
+// The miner writes it together with the published message, see publishAndStoreResumeToken.
+func (s *KafkaResumeTokenStore) StoreResumeToken(ctx context.Context, token bson.Raw) error {
+	return s.publishInTransaction(token)
+}
+
+func (s *KafkaResumeTokenStore) createResumeTokenMessage(token bson.Raw) *sarama.ProducerMessage {
+	return &sarama.ProducerMessage{
+		Topic: s.topic,
+		Key:   sarama.StringEncoder(s.watcherName),
+		Value: sarama.ByteEncoder(token),
+	}
+}
+
+// publishInTransaction sends the messages and the resume token atomically. Consumers with isolation level read committed
+// see either all messages or none of them. A nil token publishes only the messages.
+func (s *KafkaResumeTokenStore) publishInTransaction(token bson.Raw, events ...*sarama.ProducerMessage) error {
+	messages := events
+	if token != nil {
+		messages = append(messages, s.createResumeTokenMessage(token))
+	}
+
+	started := time.Now()
+	if err := s.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := s.producer.SendMessages(messages); err != nil {
+		return s.abortTransaction(fmt.Errorf("failed to send messages in transaction: %w", err))
+	}
+
+	crashAt(CrashPointBeforeCommit)
+
+	if err := s.producer.CommitTxn(); err != nil {
+		return s.abortTransaction(fmt.Errorf("failed to commit transaction: %w", err))
+	}
+
+	observePublished(started, events...)
+	if token != nil {
+		s.lastToken = token
+	}
+	return nil
+}
+
+func (s *KafkaResumeTokenStore) abortTransaction(cause error) error {
+	if s.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		return fmt.Errorf("transactional producer is in a fatal state: %w", cause)
+	}
+
+	if err := s.producer.AbortTxn(); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to abort transaction: %w", err))
+	}
+
+	return cause
+}
+
+// EnsureResumeTokenTopicExists creates the compacted resume token topic with a single partition.
+func EnsureResumeTokenTopicExists(brokers []string, topic string) error {
+	config := sarama.NewConfig()
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return fmt.Errorf("failed to create kafka cluster admin: %w", err)
+	}
+	defer admin.Close()
+
+	cleanupPolicy := "compact"
+	topicDetail := &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+		ConfigEntries: map[string]*string{
+			"cleanup.policy": &cleanupPolicy,
+		},
+	}
+
+	err = admin.CreateTopic(topic, topicDetail, false)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return fmt.Errorf("failed to create topic %s: %w", topic, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// MongoResumeTokenStore stores the resume token in a MongoDB collection, one document per watcher.
+// The miner does not need any local state with this store.
+type MongoResumeTokenStore struct {
+	collection  *mongo.Collection
+	watcherName string
+}
+
+func NewMongoResumeTokenStore(database *mongo.Database, collectionName string, watcherName string) *MongoResumeTokenStore {
+	// the resume token must survive a failover of the primary, otherwise events are published twice
+	collectionOptions := options.Collection().SetWriteConcern(writeconcern.Majority())
+
+	return &MongoResumeTokenStore{
+		collection:  database.Collection(collectionName, collectionOptions),
+		watcherName: watcherName,
+	}
+}
+
+func (s *MongoResumeTokenStore) FetchResumeToken(ctx context.Context) (bson.Raw, error) {
+	document, err := s.collection.FindOne(ctx, bson.M{"_id": s.watcherName}).Raw()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read resume token of watcher %s: %w", s.watcherName, err)
+	}
+
+	token, ok := document.Lookup("ResumeToken").DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("ResumeToken of watcher %s missing or not a document", s.watcherName)
+	}
+
+	return token, nil
+}
+
+func (s *MongoResumeTokenStore) StoreResumeToken(ctx context.Context, token bson.Raw) error {
+	document := bson.M{
+		"ResumeToken": token,
+		"UpdatedAt":   time.Now().UTC(),
+	}
+
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": s.watcherName}, document, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store resume token of watcher %s: %w", s.watcherName, err)
+	}
+
+	return nil
+}
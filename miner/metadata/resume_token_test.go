@@ -0,0 +1,141 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb/mongodbtest"
+)
+
+// The contract tests run against each store, the miner must resume the same way whichever storage is configured.
+func TestResumeTokenStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) ResumeTokenStore{
+		ResumeTokenStorageFile: func(t *testing.T) ResumeTokenStore {
+			return NewFileResumeTokenStore(t.TempDir(), "resume_token.bin")
+		},
+		ResumeTokenStorageMongoDB: func(t *testing.T) ResumeTokenStore {
+			return NewMongoResumeTokenStore(mongodbtest.Connect(t).Database("miner"), "resume_token", "file-metadata")
+		},
+	}
+
+	for storage, newStore := range stores {
+		t.Run(storage, func(t *testing.T) {
+			t.Run("fetch before store returns nil", func(t *testing.T) {
+				if token := fetchResumeToken(t, newStore(t)); token != nil {
+					t.Fatalf("FetchResumeToken returned %v, want nil", token)
+				}
+			})
+			t.Run("stored token is fetched", func(t *testing.T) {
+				store := newStore(t)
+				storeResumeToken(t, store, newResumeToken(t, "8263A1"))
+
+				assertResumeToken(t, store, newResumeToken(t, "8263A1"))
+			})
+			t.Run("store replaces token", func(t *testing.T) {
+				store := newStore(t)
+				storeResumeToken(t, store, newResumeToken(t, "8263A1"))
+				storeResumeToken(t, store, newResumeToken(t, "8263A2"))
+
+				assertResumeToken(t, store, newResumeToken(t, "8263A2"))
+			})
+		})
+	}
+}
+
+func TestFileResumeTokenStoreLeavesNoTemporaryFile(t *testing.T) {
+	directory := t.TempDir()
+	store := NewFileResumeTokenStore(directory, "resume_token.bin")
+	storeResumeToken(t, store, newResumeToken(t, "8263A1"))
+
+	assertFiles(t, directory, "resume_token.bin")
+}
+
+func TestFileResumeTokenStoreKeepsTokenOfInterruptedWrite(t *testing.T) {
+	directory := t.TempDir()
+	store := NewFileResumeTokenStore(directory, "resume_token.bin")
+	storeResumeToken(t, store, newResumeToken(t, "8263A1"))
+
+	// a crash before the rename leaves the partially written temporary file behind
+	partial := newResumeToken(t, "8263A2")[:5]
+	if err := os.WriteFile(filepath.Join(directory, "resume_token.bin.123.tmp"), partial, 0644); err != nil {
+		t.Fatalf("failed to write temporary file: %v", err)
+	}
+
+	assertResumeToken(t, store, newResumeToken(t, "8263A1"))
+}
+
+func TestFileResumeTokenStoreRemovesTemporaryFileOfFailedWrite(t *testing.T) {
+	directory := t.TempDir()
+	store := NewFileResumeTokenStore(directory, "resume_token.bin")
+	// the rename fails because a directory is in the way
+	if err := os.MkdirAll(filepath.Join(directory, "resume_token.bin", "blocked"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	if err := store.StoreResumeToken(context.Background(), newResumeToken(t, "8263A1")); err == nil {
+		t.Fatal("StoreResumeToken succeeded, want an error")
+	}
+
+	assertFiles(t, directory, "resume_token.bin")
+}
+
+// newResumeToken creates a resume token like the ones of a change stream.
+func newResumeToken(t *testing.T, data string) bson.Raw {
+	t.Helper()
+
+	token, err := bson.Marshal(bson.D{{Key: "_data", Value: data}})
+	if err != nil {
+		t.Fatalf("failed to marshal resume token: %v", err)
+	}
+
+	return token
+}
+
+func storeResumeToken(t *testing.T, store ResumeTokenStore, token bson.Raw) {
+	t.Helper()
+
+	if err := store.StoreResumeToken(context.Background(), token); err != nil {
+		t.Fatalf("StoreResumeToken failed: %v", err)
+	}
+}
+
+func fetchResumeToken(t *testing.T, store ResumeTokenStore) bson.Raw {
+	t.Helper()
+
+	token, err := store.FetchResumeToken(context.Background())
+	if err != nil {
+		t.Fatalf("FetchResumeToken failed: %v", err)
+	}
+
+	return token
+}
+
+func assertResumeToken(t *testing.T, store ResumeTokenStore, want bson.Raw) {
+	t.Helper()
+
+	if token := fetchResumeToken(t, store); !bytes.Equal(token, want) {
+		t.Fatalf("FetchResumeToken returned %v, want %v", token, want)
+	}
+}
+
+func assertFiles(t *testing.T, directory string, want ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("directory contains %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+// Clock abstracts the time, so that the backoff can be tested without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RetryPolicy describes an exponential backoff with jitter.
+type RetryPolicy struct {
+	// InitialInterval is the wait before the first retry
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two retries
+	MaxInterval time.Duration
+	// Multiplier grows the wait after each retry
+	Multiplier float64
+	// RandomizationFactor spreads the wait by +/- the factor, so that replicas do not retry in lockstep
+	RandomizationFactor float64
+	// MaxElapsedTime gives up when the failures last longer, zero retries forever
+	MaxElapsedTime time.Duration
+	// ResetAfter starts the backoff from the beginning when the operation ran longer before it failed
+	ResetAfter time.Duration
+}
+
+// IsRetryable classifies the errors of the miner, errors that are not retryable stop the miner immediately
+var IsRetryable = IsRetryableError
+
+// Supervisor restarts an operation that failed with a retryable error.
+type Supervisor struct {
+	policy      RetryPolicy
+	clock       Clock
+	isRetryable func(err error) bool
+	random      func() float64
+}
+
+func NewSupervisor(policy RetryPolicy, clock Clock, isRetryable func(err error) bool) *Supervisor {
+	return &Supervisor{
+		policy:      policy,
+		clock:       clock,
+		isRetryable: isRetryable,
+		random:      rand.Float64,
+	}
+}
+
+// Run calls operation until it returns nil, a fatal error, ctx is cancelled or the failures last longer than MaxElapsedTime.
+func (s *Supervisor) Run(ctx context.Context, operation func(ctx context.Context) error) error {
+	interval := s.policy.InitialInterval
+	var firstFailure time.Time
+
+	for restarts := 0; ; restarts++ {
+		started := s.clock.Now()
+		err := operation(ctx)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		if !s.isRetryable(err) {
+			return fmt.Errorf("fatal error after %d restarts: %w", restarts, err)
+		}
+
+		failed := s.clock.Now()
+		if s.policy.ResetAfter > 0 && failed.Sub(started) >= s.policy.ResetAfter {
+			// the operation was healthy for a while, this is a new failure
+			firstFailure = time.Time{}
+			interval = s.policy.InitialInterval
+		}
+		if firstFailure.IsZero() {
+			firstFailure = failed
+		}
+		if s.policy.MaxElapsedTime > 0 && failed.Sub(firstFailure) >= s.policy.MaxElapsedTime {
+			return fmt.Errorf("giving up after failing for %s: %w", failed.Sub(firstFailure), err)
+		}
+
+		miningRestarts.Inc()
+		delay := s.randomize(interval)
+		slog.Warn("Retryable error, restarting", "restart_in", delay, "restart", restarts+1, logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(delay):
+		}
+
+		interval = s.nextInterval(interval)
+	}
+}
+
+func (s *Supervisor) randomize(interval time.Duration) time.Duration {
+	delta := s.policy.RandomizationFactor * float64(interval)
+	// uniformly distributed in [interval - delta, interval + delta]
+	return time.Duration(float64(interval) - delta + s.random()*2*delta)
+}
+
+func (s *Supervisor) nextInterval(interval time.Duration) time.Duration {
+	next := time.Duration(float64(interval) * s.policy.Multiplier)
+	if next > s.policy.MaxInterval {
+		return s.policy.MaxInterval
+	}
+
+	return next
+}
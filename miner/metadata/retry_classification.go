@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoDB error codes, see https://www.mongodb.com/docs/manual/reference/error-codes/
+const (
+	codeHostUnreachable                 = 6
+	codeHostNotFound                    = 7
+	codeNetworkTimeout                  = 89
+	codeShutdownInProgress              = 91
+	codePrimarySteppedDown              = 189
+	codeExceededTimeLimit               = 262
+	codeChangeStreamFatalError          = 280
+	codeChangeStreamHistoryLost         = 286
+	codeSocketException                 = 9001
+	codeNotWritablePrimary              = 10107
+	codeInterruptedAtShutdown           = 11600
+	codeInterruptedDueToReplStateChange = 11602
+	codeNotPrimaryNoSecondaryOk         = 13435
+	codeNotPrimaryOrSecondary           = 13436
+	labelResumableChangeStreamError     = "ResumableChangeStreamError"
+	labelRetryableWriteError            = "RetryableWriteError"
+	labelTransientTransactionError      = "TransientTransactionError"
+)
+
+var (
+	fatalMongoCodes = []int{
+		codeChangeStreamFatalError,
+		// the resume token is older than the oplog, WatchChangeStream already fell back to a snapshot
+		codeChangeStreamHistoryLost,
+	}
+	retryableMongoCodes = []int{
+		codeHostUnreachable,
+		codeHostNotFound,
+		codeNetworkTimeout,
+		codeShutdownInProgress,
+		codePrimarySteppedDown,
+		codeExceededTimeLimit,
+		codeSocketException,
+		codeNotWritablePrimary,
+		codeInterruptedAtShutdown,
+		codeInterruptedDueToReplStateChange,
+		codeNotPrimaryNoSecondaryOk,
+		codeNotPrimaryOrSecondary,
+	}
+	retryableMongoLabels = []string{
+		labelResumableChangeStreamError,
+		labelRetryableWriteError,
+		labelTransientTransactionError,
+	}
+	fatalKafkaErrors = []sarama.KError{
+		// another miner with the same transactional id took over
+		sarama.ErrProducerFenced,
+		sarama.ErrTransactionalIDAuthorizationFailed,
+		sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed,
+		sarama.ErrMessageSizeTooLarge,
+		sarama.ErrInvalidTopic,
+	}
+)
+
+// IsRetryableError returns false for errors that can not be resolved by restarting the change stream.
+// Unknown errors are retryable, MaxElapsedTime of the retry policy stops the miner if they persist.
+func IsRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || (errors.Is(err, context.DeadlineExceeded) && !mongo.IsTimeout(err)) {
+		return false
+	}
+
+	var serverError mongo.ServerError
+	if errors.As(err, &serverError) {
+		for _, code := range fatalMongoCodes {
+			if serverError.HasErrorCode(code) {
+				return false
+			}
+		}
+		for _, code := range retryableMongoCodes {
+			if serverError.HasErrorCode(code) {
+				return true
+			}
+		}
+		for _, label := range retryableMongoLabels {
+			if serverError.HasErrorLabel(label) {
+				return true
+			}
+		}
+	}
+
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	if errors.Is(err, mongo.ErrClientDisconnected) {
+		return false
+	}
+
+	var kafkaError sarama.KError
+	if errors.As(err, &kafkaError) {
+		for _, fatal := range fatalKafkaErrors {
+			if kafkaError == fatal {
+				return false
+			}
+		}
+		return true
+	}
+
+	// e.g. sarama.ErrOutOfBrokers during a leader election of Kafka, network errors or a failed write of the resume token file
+	return true
+}
@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	errNotPrimary         = mongo.CommandError{Code: codeNotWritablePrimary, Name: "NotWritablePrimary"}
+	errHistoryLost        = mongo.CommandError{Code: codeChangeStreamHistoryLost, Name: "ChangeStreamHistoryLost"}
+	errResumableByLabel   = mongo.CommandError{Code: 1, Labels: []string{labelResumableChangeStreamError}}
+	errChangeStreamFailed = mongo.CommandError{Code: codeChangeStreamFatalError, Name: "ChangeStreamFatalError"}
+)
+
+// fakeClock does not wait, After advances the time by the duration and records it.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	elapsed := make(chan time.Time, 1)
+	elapsed <- c.now
+	return elapsed
+}
+
+// failing returns an operation that fails with err the given number of times and succeeds afterwards.
+func failing(failures int, err error) (operation func(ctx context.Context) error, calls *int) {
+	calls = new(int)
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls <= failures {
+			return err
+		}
+		return nil
+	}, calls
+}
+
+func newTestSupervisor(policy RetryPolicy, clock Clock, random float64) *Supervisor {
+	supervisor := NewSupervisor(policy, clock, IsRetryableError)
+	supervisor.random = func() float64 { return random }
+	return supervisor
+}
+
+func TestSupervisorBacksOffUpToMaxInterval(t *testing.T) {
+	clock := newFakeClock()
+	policy := RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second, Multiplier: 2}
+	operation, calls := failing(6, errNotPrimary)
+
+	err := newTestSupervisor(policy, clock, 0.5).Run(context.Background(), operation)
+
+	if err != nil {
+		t.Fatalf("Run returned %v, want nil", err)
+	}
+	if *calls != 7 {
+		t.Fatalf("operation was called %d times, want 7", *calls)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second, 8 * time.Second}
+	if !slices.Equal(clock.waits, want) {
+		t.Fatalf("waited %v, want %v", clock.waits, want)
+	}
+}
+
+func TestSupervisorRandomizesWaitWithinFactor(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: 2 * time.Second, MaxInterval: 2 * time.Second, Multiplier: 2, RandomizationFactor: 0.25}
+	tests := []struct {
+		random float64
+		want   time.Duration
+	}{
+		{random: 0, want: 1500 * time.Millisecond},
+		{random: 0.5, want: 2 * time.Second},
+		{random: 1, want: 2500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		clock := newFakeClock()
+		operation, _ := failing(1, errNotPrimary)
+
+		if err := newTestSupervisor(policy, clock, test.random).Run(context.Background(), operation); err != nil {
+			t.Fatalf("Run returned %v, want nil", err)
+		}
+		if len(clock.waits) != 1 || clock.waits[0] != test.want {
+			t.Errorf("waited %v with random %v, want %v", clock.waits, test.random, test.want)
+		}
+	}
+}
+
+func TestSupervisorGivesUpAfterMaxElapsedTime(t *testing.T) {
+	clock := newFakeClock()
+	policy := RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second, Multiplier: 2, MaxElapsedTime: 10 * time.Second}
+	operation, calls := failing(100, errNotPrimary)
+
+	err := newTestSupervisor(policy, clock, 0.5).Run(context.Background(), operation)
+
+	var commandError mongo.CommandError
+	if !errors.As(err, &commandError) || commandError.Code != codeNotWritablePrimary {
+		t.Fatalf("Run returned %v, want the error of the operation", err)
+	}
+	// the failures lasted 1+2+4+8 seconds when the fifth attempt failed
+	if *calls != 5 {
+		t.Fatalf("operation was called %d times, want 5", *calls)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	if !slices.Equal(clock.waits, want) {
+		t.Fatalf("waited %v, want %v", clock.waits, want)
+	}
+}
+
+func TestSupervisorStopsOnFatalError(t *testing.T) {
+	clock := newFakeClock()
+	policy := RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second, Multiplier: 2}
+	operation, calls := failing(100, errHistoryLost)
+
+	err := newTestSupervisor(policy, clock, 0.5).Run(context.Background(), operation)
+
+	if !IsChangeStreamHistoryLost(err) {
+		t.Fatalf("Run returned %v, want ChangeStreamHistoryLost", err)
+	}
+	if *calls != 1 || len(clock.waits) != 0 {
+		t.Fatalf("operation was called %d times after waiting %v, want one call without waiting", *calls, clock.waits)
+	}
+}
+
+func TestSupervisorStartsBackoffAgainAfterHealthyRun(t *testing.T) {
+	clock := newFakeClock()
+	policy := RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second, Multiplier: 2, ResetAfter: time.Minute}
+	calls := 0
+	operation := func(ctx context.Context) error {
+		calls++
+		if calls == 3 {
+			// the third attempt runs healthy for a while before it fails
+			clock.now = clock.now.Add(time.Minute)
+		}
+		if calls <= 4 {
+			return errNotPrimary
+		}
+		return nil
+	}
+
+	if err := newTestSupervisor(policy, clock, 0.5).Run(context.Background(), operation); err != nil {
+		t.Fatalf("Run returned %v, want nil", err)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, time.Second, 2 * time.Second}
+	if !slices.Equal(clock.waits, want) {
+		t.Fatalf("waited %v, want %v", clock.waits, want)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "not primary", err: errNotPrimary, want: true},
+		{name: "resumable change stream label", err: errResumableByLabel, want: true},
+		{name: "change stream history lost", err: errHistoryLost, want: false},
+		{name: "change stream fatal error", err: errChangeStreamFailed, want: false},
+		{name: "wrapped not primary", err: errors.Join(errors.New("failed to watch"), errNotPrimary), want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "client disconnected", err: mongo.ErrClientDisconnected, want: false},
+		{name: "producer fenced", err: sarama.ErrProducerFenced, want: false},
+		{name: "kafka leader not available", err: sarama.ErrLeaderNotAvailable, want: true},
+		{name: "out of brokers", err: sarama.ErrOutOfBrokers, want: true},
+		{name: "unknown", err: errors.New("unknown"), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryableError(test.err); got != test.want {
+				t.Fatalf("IsRetryableError(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/IBM/sarama"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snapshotAndWatch publishes a FileStored event for every stored file and tails the change stream afterwards.
+// The change stream starts at the cluster time before the scan, so no change is lost between the scan and the change stream.
+// Files that changed during the scan are published twice.
+func (m *miner) snapshotAndWatch(ctx context.Context, collection *mongo.Collection) error {
+	clusterTime, err := fetchClusterTime(ctx, collection.Database().Client())
+	if err != nil {
+		return err
+	}
+
+	if err := m.publishSnapshot(ctx, collection, clusterTime); err != nil {
+		return err
+	}
+
+	slog.Info("Snapshot completed, tailing change stream", "cluster_time", formatClusterTime(clusterTime))
+	changeStreamOptions := NewChangeStreamOptions().SetStartAtOperationTime(&clusterTime)
+	return m.watchChangeStreamEvents(ctx, collection, changeStreamOptions, true)
+}
+
+// publishSnapshot publishes the stored files as FileStored events marked with the snapshot header.
+// Incomplete uploads are skipped, they are announced by the change stream when they are completed.
+func (m *miner) publishSnapshot(ctx context.Context, collection *mongo.Collection, clusterTime primitive.Timestamp) error {
+	slog.Info("Publishing snapshot of stored files")
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"StoredAt": bson.M{"$exists": true}}, findOptions)
+	if err != nil {
+		return fmt.Errorf("failed to query stored files: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	published := 0
+	for cursor.Next(ctx) {
+		var document bson.M
+		if err := cursor.Decode(&document); err != nil {
+			return fmt.Errorf("failed to decode stored file: %w", err)
+		}
+
+		// the snapshot looks like an insert of the complete document, so that the event builders can be reused
+		change := bson.M{
+			"operationType": "insert",
+			"clusterTime":   clusterTime,
+			"fullDocument":  document,
+		}
+		metadata := EventMetadata{
+			ClusterTime:   clusterTime,
+			CorrelationId: uuid.NewString(),
+		}
+
+		kafkaMsg, err := m.createMessage(ctx, change, metadata)
+		if err != nil {
+			return err
+		}
+		if kafkaMsg == nil {
+			continue
+		}
+		kafkaMsg.Headers = append(kafkaMsg.Headers, sarama.RecordHeader{Key: []byte(HeaderSnapshot), Value: []byte("true")})
+
+		_, span := startPublishSpan(ctx, change, kafkaMsg)
+		err = m.publishSnapshotMessage(kafkaMsg)
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to publish snapshot: %w", err)
+		}
+		published++
+		markProgress()
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("cursor error: %w", err)
+	}
+
+	slog.Info("Published snapshot of stored files", "count", published)
+	return nil
+}
+
+func (m *miner) publishSnapshotMessage(kafkaMsg *sarama.ProducerMessage) error {
+	if m.transaction != nil {
+		// the transactional producer can only send within a transaction
+		return m.transaction.publishInTransaction(nil, kafkaMsg)
+	}
+
+	return m.publisher.publishMessage(kafkaMsg)
+}
+
+// fetchClusterTime returns the operation time of a ping, every change after it is contained in a change stream started at this time.
+func fetchClusterTime(ctx context.Context, client *mongo.Client) (primitive.Timestamp, error) {
+	reply, err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Raw()
+	if err != nil {
+		return primitive.Timestamp{}, fmt.Errorf("failed to fetch cluster time: %w", err)
+	}
+
+	t, i, ok := reply.Lookup("operationTime").TimestampOK()
+	if !ok {
+		return primitive.Timestamp{}, fmt.Errorf("operationTime missing, MongoDB must run as replica set")
+	}
+
+	return primitive.Timestamp{T: t, I: i}, nil
+}
+
+// IsChangeStreamHistoryLost returns true if the resume token is older than the oldest entry of the oplog.
+func IsChangeStreamHistoryLost(err error) bool {
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorCode(codeChangeStreamHistoryLost)
+}
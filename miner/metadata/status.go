@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var lastProgress atomic.Int64
+
+type status struct {
+	InstanceId string `json:"instanceId"`
+	Role       Role   `json:"role"`
+}
+
+// StatusHandler reports whether this miner instance currently tails the change stream.
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status{
+		InstanceId: InstanceId,
+		Role:       CurrentRole(),
+	})
+}
+
+// markProgress records that the miner tails the change stream, it is called for each change event and each empty batch.
+func markProgress() {
+	lastProgress.Store(time.Now().UnixNano())
+}
+
+// ProgressCheck fails if the change stream neither delivered a change event nor an empty batch within maxAge,
+// the miner is then reported as stuck. A follower does not tail the change stream, its leader is checked instead.
+func ProgressCheck(maxAge time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		last := lastProgress.Load()
+		if CurrentRole() == RoleFollower || last == 0 {
+			return nil
+		}
+
+		age := time.Since(time.Unix(0, last))
+		if age > maxAge {
+			return fmt.Errorf("no progress on the change stream for %s", age.Truncate(time.Second))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package metadata
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+)
+
+var tracer = otel.Tracer("github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/miner/metadata")
+
+// startPublishSpan continues the trace the producer stored in the document of the change and injects it into the record headers.
+// A delete has no document after the change, its event starts a new trace.
+func startPublishSpan(ctx context.Context, change bson.M, kafkaMsg *sarama.ProducerMessage) (context.Context, trace.Span) {
+	if fullDocument, ok := change["fullDocument"].(bson.M); ok {
+		ctx = tracing.ExtractDocument(ctx, fullDocument)
+	}
+
+	ctx, span := tracer.Start(ctx, kafkaMsg.Topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.operation.type", "publish"),
+			attribute.String("messaging.destination.name", kafkaMsg.Topic),
+			attribute.String("event.type", HeaderValue(kafkaMsg.Headers, HeaderEventType)),
+			attribute.String("correlation.id", HeaderValue(kafkaMsg.Headers, HeaderCorrelationId)),
+		))
+	tracing.InjectMessage(ctx, kafkaMsg)
+
+	return ctx, span
+}
@@ -1,46 +1,84 @@
 package metadata
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"time"
 
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-)
 
-const ResumeTokenDirectory = "app/data"
-const ResumeTokenFile = "resume_token.bin"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+)
 
-var (
-	client              *mongo.Client
-	ResumeTokenFilePath = filepath.Join(ResumeTokenDirectory, ResumeTokenFile)
+const (
+	ResumeTokenStorageFile    = "file"
+	ResumeTokenStorageMongoDB = "mongodb"
 )
 
-func MiningFileMetadata(ctx context.Context) error {
-	fmt.Println("Mining file metadata...")
+// miner tails the change stream during one term and publishes the changes, see mineFileMetadata.
+type miner struct {
+	cfg          Config
+	publisher    *Publisher
+	resumeTokens ResumeTokenStore
+	// transaction is set with transactional publishing, the resume token is then stored in the transaction of the event
+	transaction *KafkaResumeTokenStore
+}
+
+func MiningFileMetadata(ctx context.Context, cfg Config, db mongodb.Connection) error {
+	slog.Info("Mining file metadata")
+
+	supervisor := NewSupervisor(cfg.Retry.Policy(), SystemClock{}, IsRetryable)
+	mine := func(ctx context.Context) error {
+		return supervisor.Run(ctx, func(ctx context.Context) error {
+			return mineFileMetadata(ctx, cfg, db)
+		})
+	}
+
+	if !cfg.Leader.Enabled {
+		return mine(ctx)
+	}
 
-	if err := initializeMongoClient(ctx); err != nil {
+	elector := NewLeaderElector(db.Database("miner"), "lease", cfg.WatcherName, InstanceId, cfg.Leader.LeaseDuration, cfg.Leader.RenewInterval)
+	if err := elector.EnsureLeaseIndex(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("Miner waits for lease", "instance_id", InstanceId, "lease", cfg.WatcherName)
+	return elector.Run(ctx, mine)
+}
+
+// mineFileMetadata tails the change stream. With leader election it is called again each time this instance becomes leader,
+// the resume token store and the producer are created for each term, so that the resume token of the previous leader is used.
+func mineFileMetadata(ctx context.Context, cfg Config, db mongodb.Connection) error {
+	markProgress()
+
+	publisher, err := NewPublisher(cfg)
+	if err != nil {
 		return err
 	}
-	defer disconnectMongoClient()
+	defer publisher.Close()
 
-	if err := CreateEventProducer(); err != nil {
+	m := &miner{cfg: cfg, publisher: publisher}
+	if err := m.createResumeTokenStore(db.Database("miner")); err != nil {
 		return err
 	}
-	defer CloseEventProducer()
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Println("Context cancelled, mining file metadata stopped")
+			slog.Info("Context cancelled, mining file metadata stopped")
 			return ctx.Err()
 		default:
-			if err := WatchChangeStream(ctx); err != nil {
+			if err := m.watchChangeStream(ctx, db.Database("store_file").Collection("file")); err != nil {
 				if ctx.Err() != nil && (ctx.Err() == context.Canceled || ctx.Err() == context.DeadlineExceeded) {
 					return ctx.Err()
 				}
@@ -51,31 +89,49 @@ func MiningFileMetadata(ctx context.Context) error {
 	}
 }
 
-func WatchChangeStream(ctx context.Context) error {
-	fmt.Println("Watching change stream for file metadata...")
+func (m *miner) watchChangeStream(ctx context.Context, collection *mongo.Collection) error {
+	slog.Info("Watching change stream for file metadata")
 
-	if err := EnsureResumeTokenDirectoryExists(); err != nil {
-		return fmt.Errorf("failed to create resume token directory: %w", err)
-	}
-
-	resumeToken, err := FetchResumeToken(ctx)
+	resumeToken, err := m.resumeTokens.FetchResumeToken(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch resume token: %w", err)
 	}
 
-	collection := client.Database("store_file").Collection("file")
-	changeStreamOptions := options.ChangeStream().SetFullDocument(options.Required)
-	changeStreamOptions = ResumeChangeStreamIfPossible(resumeToken, changeStreamOptions)
+	if resumeToken == nil {
+		slog.Info("No resume token stored, starting with a snapshot")
+		return m.snapshotAndWatch(ctx, collection)
+	}
+
+	slog.Info("Resuming change stream from previous token", logging.ResumeToken(resumeToken))
+	changeStreamOptions := NewChangeStreamOptions().SetResumeAfter(resumeToken)
+	err = m.watchChangeStreamEvents(ctx, collection, changeStreamOptions, false)
+	if IsChangeStreamHistoryLost(err) {
+		slog.Warn("Resume token is no longer in the oplog, starting with a snapshot", logging.ResumeToken(resumeToken))
+		return m.snapshotAndWatch(ctx, collection)
+	}
+
+	return err
+}
 
-	return WatchChangeStreamEvents(ctx, collection, changeStreamOptions)
+func NewChangeStreamOptions() *options.ChangeStreamOptions {
+	return options.ChangeStream().
+		SetFullDocument(options.Required).
+		// the pre-image of a delete provides the file id, the document key only contains the object id
+		SetFullDocumentBeforeChange(options.WhenAvailable)
 }
 
-func WatchChangeStreamEvents(ctx context.Context, collection *mongo.Collection, changeStreamOptions *options.ChangeStreamOptions) error {
+// watchChangeStreamEvents publishes the events of the change stream. With storeInitialResumeToken the resume token of the opened
+// change stream is stored before the first change arrives, so that a restart does not start from the beginning again.
+func (m *miner) watchChangeStreamEvents(ctx context.Context, collection *mongo.Collection, changeStreamOptions *options.ChangeStreamOptions, storeInitialResumeToken bool) error {
+	storedAtExists := bson.D{{Key: "$exists", Value: true}}
+	// files are complete as soon as StoredAt is set, either by a single insert or replace, or by a later update
 	pipeline := mongo.Pipeline{
-		bson.D{{Key: "$match", Value: bson.D{
-			{Key: "operationType", Value: "update"},
-			{Key: "updateDescription.updatedFields.StoredAt", Value: bson.D{{Key: "$exists", Value: true}}},
-		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "operationType", Value: "insert"}, {Key: "fullDocument.StoredAt", Value: storedAtExists}},
+			bson.D{{Key: "operationType", Value: "replace"}, {Key: "fullDocument.StoredAt", Value: storedAtExists}},
+			bson.D{{Key: "operationType", Value: "update"}, {Key: "updateDescription.updatedFields.StoredAt", Value: storedAtExists}},
+			bson.D{{Key: "operationType", Value: "delete"}},
+		}}}}},
 	}
 	changeStream, err := collection.Watch(ctx, pipeline, changeStreamOptions)
 	if err != nil {
@@ -83,103 +139,151 @@ func WatchChangeStreamEvents(ctx context.Context, collection *mongo.Collection,
 	}
 	defer changeStream.Close(ctx)
 
-	for changeStream.Next(ctx) {
+	idleTokens := idleResumeTokens{resumeTokens: m.resumeTokens, storage: m.cfg.resumeTokenStorage(), interval: m.cfg.ResumeToken.IdleInterval, stored: time.Now()}
+	if storeInitialResumeToken && changeStream.ResumeToken() != nil {
+		started := time.Now()
+		if err := m.resumeTokens.StoreResumeToken(ctx, changeStream.ResumeToken()); err != nil {
+			return fmt.Errorf("failed to store initial resume token: %w", err)
+		}
+		observeResumeTokenWrite(started, m.cfg.resumeTokenStorage())
+	}
+
+	for {
+		// TryNext returns after each empty batch, so that the liveness check sees progress while no file changes
+		if !changeStream.TryNext(ctx) {
+			if err := changeStream.Err(); err != nil {
+				if err == context.Canceled {
+					return ctx.Err()
+				}
+				return fmt.Errorf("error in change stream: %w", err)
+			}
+			if changeStream.ID() == 0 {
+				// the change stream was invalidated, e.g. the collection was dropped
+				return nil
+			}
+			markProgress()
+			if err := idleTokens.store(ctx, changeStream.ResumeToken()); err != nil {
+				return err
+			}
+			continue
+		}
+		markProgress()
+
 		var change bson.M
 		if err := changeStream.Decode(&change); err != nil {
 			return fmt.Errorf("failed to decode change stream event: %w", err)
 		}
-		fmt.Printf("Change detected: %v\n", change)
 
-		event, err := CreateFileStoredEvent(change)
-		if err != nil {
-			return fmt.Errorf("failed to create file stored event: %w", err)
+		metadata := EventMetadata{
+			ResumeToken:   changeStream.ResumeToken(),
+			CorrelationId: uuid.NewString(),
 		}
-
-		err = PublishEvent(event)
-		if err != nil {
-			return fmt.Errorf("failed to publish event: %w", err)
+		if clusterTime, ok := change["clusterTime"].(primitive.Timestamp); ok {
+			metadata.ClusterTime = clusterTime
 		}
-
-		resumeToken := changeStream.ResumeToken()
-		err = StoreResumeToken(ctx, resumeToken)
+		observeChangeEvent(change["operationType"], metadata.ClusterTime)
+		slog.Info("Change detected",
+			"operation_type", change["operationType"],
+			"cluster_time", formatClusterTime(metadata.ClusterTime),
+			logging.KeyCorrelationId, metadata.CorrelationId,
+			logging.ResumeToken(metadata.ResumeToken),
+			logging.Document(change))
+
+		kafkaMsg, err := m.createMessage(ctx, change, metadata)
 		if err != nil {
-			return fmt.Errorf("failed to store resume token: %w", err)
+			return err
+		}
+		if kafkaMsg == nil {
+			slog.Info("Change does not lead to an event", "operation_type", change["operationType"], logging.KeyCorrelationId, metadata.CorrelationId)
+			continue
 		}
-	}
 
-	if err := changeStream.Err(); err != nil {
-		if err == context.Canceled {
-			return ctx.Err()
+		spanCtx, span := startPublishSpan(ctx, change, kafkaMsg)
+		err = m.publishAndStoreResumeToken(spanCtx, kafkaMsg, metadata.ResumeToken)
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to publish: %w", err)
 		}
-		return fmt.Errorf("error in change stream: %w", err)
+		idleTokens.published(metadata.ResumeToken)
 	}
+}
 
-	return nil
+// idleResumeTokens stores the post batch resume token of empty batches. The change stream filters most changes of the oplog,
+// without it the stored resume token can fall out of the oplog while no file is stored and the miner has to start with a snapshot.
+type idleResumeTokens struct {
+	resumeTokens ResumeTokenStore
+	// storage is the label of the resume token metrics
+	storage  string
+	interval time.Duration
+	stored   time.Time
+	token    bson.Raw
 }
 
-func ResumeChangeStreamIfPossible(resumeToken bson.Raw, changeStreamOptions *options.ChangeStreamOptions) *options.ChangeStreamOptions {
-	if resumeToken != nil {
-		fmt.Println("Resuming change stream from previous token")
-		changeStreamOptions = changeStreamOptions.SetResumeAfter(resumeToken)
-	} else {
-		// Fetch everything that is still retained in the oplog
-		// Do not use this in production
-		changeStreamOptions = changeStreamOptions.SetStartAtOperationTime(&primitive.Timestamp{T: 1})
+// store writes the resume token if it moved and the last resume token was stored at least one interval ago.
+func (t *idleResumeTokens) store(ctx context.Context, token bson.Raw) error {
+	if t.interval <= 0 || token == nil || bytes.Equal(token, t.token) || time.Since(t.stored) < t.interval {
+		return nil
 	}
 
-	return changeStreamOptions
+	started := time.Now()
+	if err := t.resumeTokens.StoreResumeToken(ctx, token); err != nil {
+		return fmt.Errorf("failed to store resume token of empty batch: %w", err)
+	}
+	observeResumeTokenWrite(started, t.storage)
+	t.published(token)
+
+	return nil
 }
 
-func EnsureResumeTokenDirectoryExists() error {
-	return os.MkdirAll(ResumeTokenDirectory, 0755)
+// published records the resume token stored together with an event.
+func (t *idleResumeTokens) published(token bson.Raw) {
+	t.stored = time.Now()
+	t.token = token
 }
 
-func FetchResumeToken(ctx context.Context) (bson.Raw, error) {
-	data, err := os.ReadFile(ResumeTokenFilePath)
+// createMessage creates the event of the change. A change that can not be converted is published to the dead letter topic instead,
+// so that it does not block the change stream.
+func (m *miner) createMessage(ctx context.Context, change bson.M, metadata EventMetadata) (*sarama.ProducerMessage, error) {
+	event, err := m.cfg.DeadLetter.CreateEventWithRetries(ctx, change)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+		if !m.cfg.DeadLetter.Enabled || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to create event: %w", err)
 		}
 
-		return nil, fmt.Errorf("failed to read resume token file: %w", err)
+		slog.Error("Change is dead lettered", logging.KeyCorrelationId, metadata.CorrelationId, logging.Error(err), logging.Document(change))
+		return m.cfg.DeadLetter.createDeadLetterMessage(change, err, metadata)
+	}
+	if event == nil {
+		return nil, nil
 	}
 
-	return bson.Raw(data), nil
-}
-
-func StoreResumeToken(ctx context.Context, token bson.Raw) error {
-	return os.WriteFile(ResumeTokenFilePath, token, 0644)
+	return m.publisher.createEventMessage(event, metadata)
 }
 
-func initializeMongoClient(ctx context.Context) error {
-	if client == nil {
-		var err error
-		clientOptions := options.Client().
-			ApplyURI("mongodb://localhost:27017/?replicaSet=rs0")
-		client, err = mongo.Connect(ctx, clientOptions)
-		if err != nil {
-			return fmt.Errorf("failed to connect to MongoDB: %v", err)
-		}
-		fmt.Println("MongoDB client initialized")
-
-		if err := client.Ping(ctx, nil); err != nil {
-			return fmt.Errorf("failed to ping MongoDB: %v", err)
+// createResumeTokenStore selects where the resume token is stored. With transactional publishing it is stored in the transaction of the event,
+// otherwise use ResumeTokenStorageMongoDB to run the miner without local state.
+func (m *miner) createResumeTokenStore(database *mongo.Database) error {
+	cfg := m.cfg
+	if cfg.Transactional.Enabled {
+		if err := EnsureResumeTokenTopicExists(cfg.Kafka.Brokers, cfg.Transactional.ResumeTokenTopic); err != nil {
+			return err
 		}
-		fmt.Println("MongoDB ping successful")
+		m.transaction = NewKafkaResumeTokenStore(cfg.Kafka.Brokers, cfg.Transactional.ResumeTokenTopic, cfg.WatcherName, m.publisher)
+		m.resumeTokens = m.transaction
+		slog.Info("Resume token is stored within the event transaction", logging.KeyTopic, cfg.Transactional.ResumeTokenTopic)
+		return nil
 	}
-	return nil
-}
-
-func disconnectMongoClient() {
-	if client != nil {
-		// Create a new context with timeout for disconnect operation, the application context might be cancelled
-		disconnectCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
 
-		if err := client.Disconnect(disconnectCtx); err != nil {
-			fmt.Printf("Failed to disconnect MongoDB client: %v\n", err)
-		} else {
-			fmt.Println("MongoDB client disconnected")
-		}
+	switch cfg.ResumeToken.Storage {
+	case ResumeTokenStorageFile:
+		m.resumeTokens = NewFileResumeTokenStore(cfg.ResumeToken.Directory, cfg.ResumeToken.File)
+	case ResumeTokenStorageMongoDB:
+		// the watcher name identifies the resume token of this change stream in the shared store
+		m.resumeTokens = NewMongoResumeTokenStore(database, "resume_token", cfg.WatcherName)
+	default:
+		return fmt.Errorf("resume token storage %q is not supported", cfg.ResumeToken.Storage)
 	}
+
+	slog.Info("Resume token storage selected", "storage", cfg.ResumeToken.Storage)
+	return nil
 }
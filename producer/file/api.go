@@ -0,0 +1,35 @@
+package file
+
+import (
+	"net/http"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+// RegisterFileAPI registers the upload and the download of files. Requests with the Tus-Resumable header belong to a resumable upload.
+func RegisterFileAPI(mux *http.ServeMux, db mongodb.Connection, store storage.BlobStore, options Options) {
+	collection := FileCollection(db)
+	upload := UploadHandler(collection, store, options)
+	createUpload := TusCreateHandler(collection, store, options)
+	download := DownloadHandler(collection, store)
+	uploadOffset := TusHeadHandler(collection)
+
+	mux.HandleFunc("POST /files", func(w http.ResponseWriter, r *http.Request) {
+		if IsTusRequest(r) {
+			createUpload(w, r)
+			return
+		}
+		upload(w, r)
+	})
+	mux.Handle("OPTIONS /files", TusOptionsHandler(options))
+	mux.Handle("PATCH /files/{fileId}", TusPatchHandler(collection, store, options))
+	mux.Handle("GET /files/{fileId}", download)
+	mux.HandleFunc("HEAD /files/{fileId}", func(w http.ResponseWriter, r *http.Request) {
+		if IsTusRequest(r) {
+			uploadOffset(w, r)
+			return
+		}
+		download(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum of the content of a file, it is stored in the field Checksum of the file document.
+type Checksum struct {
+	SHA256 []byte `bson:"SHA256"`
+	// CRC32C is stored as int64, BSON has no unsigned integers
+	CRC32C *int64 `bson:"CRC32C,omitempty"`
+}
+
+// HashState is the state of the ContentHash after the bytes received so far, a resumable upload continues it with the next chunk.
+type HashState struct {
+	SHA256 []byte `bson:"SHA256"`
+	CRC32C []byte `bson:"CRC32C,omitempty"`
+}
+
+// ContentHash computes the checksum of the content while it is written.
+type ContentHash struct {
+	sha256 hash.Hash
+	crc32c hash.Hash32
+}
+
+// NewContentHash computes the SHA-256 of the content and with withCRC32C also its CRC32C.
+func NewContentHash(withCRC32C bool) *ContentHash {
+	contentHash := &ContentHash{sha256: sha256.New()}
+	if withCRC32C {
+		contentHash.crc32c = crc32.New(castagnoli)
+	}
+	return contentHash
+}
+
+// RestoreContentHash continues the hash of a resumable upload. The CRC32C is only computed if the upload started with it.
+func RestoreContentHash(state HashState) (*ContentHash, error) {
+	contentHash := &ContentHash{sha256: sha256.New()}
+	if err := contentHash.sha256.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.SHA256); err != nil {
+		return nil, fmt.Errorf("failed to restore sha256: %w", err)
+	}
+	if state.CRC32C != nil {
+		contentHash.crc32c = crc32.New(castagnoli)
+		if err := contentHash.crc32c.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.CRC32C); err != nil {
+			return nil, fmt.Errorf("failed to restore crc32c: %w", err)
+		}
+	}
+	return contentHash, nil
+}
+
+func (h *ContentHash) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	if h.crc32c != nil {
+		h.crc32c.Write(p)
+	}
+	return len(p), nil
+}
+
+func (h *ContentHash) Checksum() Checksum {
+	checksum := Checksum{SHA256: h.sha256.Sum(nil)}
+	if h.crc32c != nil {
+		crc := int64(h.crc32c.Sum32())
+		checksum.CRC32C = &crc
+	}
+	return checksum
+}
+
+func (h *ContentHash) State() (HashState, error) {
+	var state HashState
+	var err error
+	if state.SHA256, err = h.sha256.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return HashState{}, fmt.Errorf("failed to save sha256: %w", err)
+	}
+	if h.crc32c != nil {
+		if state.CRC32C, err = h.crc32c.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+			return HashState{}, fmt.Errorf("failed to save crc32c: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// hashingWriter hashes the bytes that were written to the file, so that the hash matches the file also after a failed write.
+type hashingWriter struct {
+	writer io.Writer
+	hash   *ContentHash
+}
+
+func (w hashingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,71 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash/crc32"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testContent = []byte("content of a resumable upload that arrives in several chunks")
+
+// A resumable upload saves the state of the hash in the upload document after each chunk and restores it for the next chunk.
+func TestRestoredContentHashContinuesAcrossChunks(t *testing.T) {
+	for _, withCRC32C := range []bool{false, true} {
+		state, err := NewContentHash(withCRC32C).State()
+		if err != nil {
+			t.Fatalf("State failed: %v", err)
+		}
+		for _, chunk := range [][]byte{testContent[:7], testContent[7:30], testContent[30:]} {
+			contentHash, err := RestoreContentHash(storeHashState(t, state))
+			if err != nil {
+				t.Fatalf("RestoreContentHash failed: %v", err)
+			}
+			contentHash.Write(chunk)
+			if state, err = contentHash.State(); err != nil {
+				t.Fatalf("State failed: %v", err)
+			}
+		}
+		contentHash, err := RestoreContentHash(storeHashState(t, state))
+		if err != nil {
+			t.Fatalf("RestoreContentHash failed: %v", err)
+		}
+
+		checksum := contentHash.Checksum()
+
+		wantSHA256 := sha256.Sum256(testContent)
+		if !bytes.Equal(checksum.SHA256, wantSHA256[:]) {
+			t.Errorf("sha256 with crc32c %v is %x, want %x", withCRC32C, checksum.SHA256, wantSHA256)
+		}
+		switch {
+		case !withCRC32C && checksum.CRC32C != nil:
+			t.Errorf("crc32c is %d, want none for an upload that started without it", *checksum.CRC32C)
+		case withCRC32C && (checksum.CRC32C == nil || *checksum.CRC32C != int64(crc32.Checksum(testContent, castagnoli))):
+			t.Errorf("crc32c is %v, want %d", checksum.CRC32C, crc32.Checksum(testContent, castagnoli))
+		}
+	}
+}
+
+func TestRestoreContentHashFailsOnInvalidState(t *testing.T) {
+	if _, err := RestoreContentHash(HashState{SHA256: []byte("invalid")}); err == nil {
+		t.Fatal("RestoreContentHash succeeded, want an error")
+	}
+}
+
+// storeHashState returns the state as it is read from the upload document.
+func storeHashState(t *testing.T, state HashState) HashState {
+	t.Helper()
+
+	document, err := bson.Marshal(state)
+	if err != nil {
+		t.Fatalf("failed to marshal hash state: %v", err)
+	}
+	var stored HashState
+	if err := bson.Unmarshal(document, &stored); err != nil {
+		t.Fatalf("failed to unmarshal hash state: %v", err)
+	}
+
+	return stored
+}
@@ -0,0 +1,93 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// Config of the producer, loaded with the shared config package.
+type Config struct {
+	Logging     config.Logging `yaml:"logging"`
+	Tracing     config.Tracing `yaml:"tracing"`
+	MongoDB     config.MongoDB `yaml:"mongodb"`
+	Storage     config.Storage `yaml:"storage"`
+	HTTPAddress string         `yaml:"httpAddress" env:"PRODUCER_HTTP_ADDRESS" flag:"http-address" usage:"address of the upload API and the health endpoints"`
+	Health      config.Health  `yaml:"health"`
+	// Mode selects between the upload API and the load generator that stores random files
+	Mode          string          `yaml:"mode" env:"PRODUCER_MODE" flag:"mode" usage:"http serves the upload API, simulate stores random files"`
+	MaxUploadSize int64           `yaml:"maxUploadSize" env:"PRODUCER_MAX_UPLOAD_SIZE" flag:"max-upload-size" usage:"maximum size of an uploaded file in bytes"`
+	MediaTypes    MediaTypeConfig `yaml:"mediaTypes"`
+	// the SHA-256 of every file is computed, the CRC32C only on demand
+	ChecksumCRC32C bool `yaml:"checksumCRC32C" env:"PRODUCER_CHECKSUM_CRC32C" flag:"checksum-crc32c" usage:"compute a CRC32C of every file in addition to the SHA-256"`
+}
+
+// MediaTypeConfig controls which files are accepted, the media type is detected from the content.
+type MediaTypeConfig struct {
+	Allowed        []string `yaml:"allowed" env:"PRODUCER_ALLOWED_MEDIA_TYPES" flag:"allowed-media-types" usage:"media types that can be uploaded, image/* allows all images and */* every type"`
+	RejectMismatch bool     `yaml:"rejectMismatch" env:"PRODUCER_REJECT_MEDIA_TYPE_MISMATCH" flag:"reject-media-type-mismatch" usage:"reject a file whose content does not match the declared media type instead of storing the detected type"`
+}
+
+const (
+	ModeHTTP     = "http"
+	ModeSimulate = "simulate"
+)
+
+func DefaultConfig() Config {
+	return Config{
+		Logging:       config.DefaultLogging(),
+		Tracing:       config.DefaultTracing(),
+		MongoDB:       config.DefaultMongoDB(),
+		Storage:       config.DefaultStorage("storage"),
+		HTTPAddress:   ":8082",
+		Health:        config.DefaultHealth(),
+		Mode:          ModeHTTP,
+		MaxUploadSize: 100 << 20,
+		MediaTypes: MediaTypeConfig{
+			Allowed:        []string{"text/plain", "text/csv", "application/json", "application/pdf", "image/*"},
+			RejectMismatch: true,
+		},
+	}
+}
+
+func (c *Config) Validate() error {
+	var modeErr error
+	if c.Mode != ModeHTTP && c.Mode != ModeSimulate {
+		modeErr = fmt.Errorf("mode %q is not supported, use %s or %s", c.Mode, ModeHTTP, ModeSimulate)
+	}
+
+	var mediaTypesErr error
+	if len(c.MediaTypes.Allowed) == 0 {
+		mediaTypesErr = errors.New("at least one media type must be allowed")
+	}
+
+	return errors.Join(
+		c.MongoDB.Validate(),
+		c.Storage.Validate(),
+		c.Health.Validate(),
+		c.Logging.Validate(),
+		c.Tracing.Validate(),
+		modeErr,
+		config.Positive("max upload size", c.MaxUploadSize),
+		mediaTypesErr,
+	)
+}
+
+// Options are the settings of storing a file.
+type Options struct {
+	// MaxUploadSize is the maximum size of an uploaded file in bytes
+	MaxUploadSize int64
+	MediaTypes    MediaTypeConfig
+	// ChecksumCRC32C adds a CRC32C to the SHA-256 of the content, e.g. to compare it with the checksum of an object storage
+	ChecksumCRC32C bool
+}
+
+// Options returns the settings main passes to RegisterFileAPI and SimulateStoreFile.
+func (c Config) Options() Options {
+	return Options{
+		MaxUploadSize:  c.MaxUploadSize,
+		MediaTypes:     c.MediaTypes,
+		ChecksumCRC32C: c.ChecksumCRC32C,
+	}
+}
@@ -2,6 +2,7 @@ package file
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"time"
@@ -11,31 +12,29 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
 var (
 	ErrorProbabilityFileId   float64 = 0.01
 	ErrorProbabilityMetadata float64 = 0.1
-	client                   *mongo.Client
 )
 
-func StoreFileId(ctx context.Context, fileId uuid.UUID) (primitive.ObjectID, error) {
+// FileCollection returns the collection of the file metadata.
+func FileCollection(db mongodb.Connection) *mongo.Collection {
+	return db.Database("store_file").Collection("file")
+}
+
+func StoreFileId(ctx context.Context, collection *mongo.Collection, fileId uuid.UUID) (primitive.ObjectID, error) {
 	if rand.Float64() < ErrorProbabilityFileId {
 		return primitive.NilObjectID, fmt.Errorf("Failed to write to database")
 	}
 
-	collection := client.Database("store_file").Collection("file")
-
 	objectId := primitive.NewObjectID()
 
-	document := bson.M{
-		"_id":       objectId,
-		"FileId":    primitive.Binary{Subtype: 4, Data: fileId[:]}, // store UUID as BSON binary subtype 4
-		"CreatedAt": time.Now().UTC(),
-	}
-
-	_, err := collection.InsertOne(ctx, document)
+	_, err := collection.InsertOne(ctx, newFileDocument(ctx, objectId, fileId))
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("failed to insert file id: %w", err)
 	}
@@ -43,18 +42,34 @@ func StoreFileId(ctx context.Context, fileId uuid.UUID) (primitive.ObjectID, err
 	return objectId, nil
 }
 
-func StoreFileMetadata(ctx context.Context, objectId primitive.ObjectID, size uint64, mediaType string) error {
+func newFileDocument(ctx context.Context, objectId primitive.ObjectID, fileId uuid.UUID) bson.M {
+	return bson.M{
+		"_id":       objectId,
+		"FileId":    fileIdValue(fileId),
+		"CreatedAt": time.Now().UTC(),
+		// the miner continues the trace of the upload
+		tracing.DocumentField: tracing.InjectDocument(ctx),
+	}
+}
+
+// fileIdValue stores the UUID as BSON binary subtype 4
+func fileIdValue(fileId uuid.UUID) primitive.Binary {
+	return primitive.Binary{Subtype: 4, Data: fileId[:]}
+}
+
+func StoreFileMetadata(ctx context.Context, collection *mongo.Collection, objectId primitive.ObjectID, size uint64, mediaType string, extension string, checksum Checksum) error {
 	if rand.Float64() < ErrorProbabilityMetadata {
 		return fmt.Errorf("Failed to write to database")
 	}
 
-	collection := client.Database("store_file").Collection("file")
-
 	document := bson.M{
-		"Extension": ".txt",
-		"MediaType": "text/plain",
+		"Extension": extension,
+		"MediaType": mediaType,
+		"Checksum":  checksum,
 		"Size":      size,
 		"StoredAt":  time.Now().UTC(),
+		// the update completes the file, its trace context is the one the miner continues
+		tracing.DocumentField: tracing.InjectDocument(ctx),
 	}
 
 	_, err := collection.UpdateByID(ctx, objectId, bson.M{"$set": document})
@@ -65,40 +80,128 @@ func StoreFileMetadata(ctx context.Context, objectId primitive.ObjectID, size ui
 	return nil
 }
 
-func InitializeMongoClient(ctx context.Context) error {
-	if client == nil {
-		var err error
-		clientOptions := options.Client().
-			ApplyURI("mongodb://localhost:27017/?replicaSet=rs0")
+// ErrUploadNotFound is returned if no resumable upload exists for the file id
+var ErrUploadNotFound = errors.New("upload not found")
+
+// Upload is the state of a resumable upload, it is stored in the field Upload of the file document.
+type Upload struct {
+	Length      int64     `bson:"Length"`
+	Offset      int64     `bson:"Offset"`
+	MediaType   string    `bson:"MediaType"`
+	Extension   string    `bson:"Extension"`
+	LastChunkAt time.Time `bson:"LastChunkAt"`
+	// HashState is the state of the checksum after Offset bytes
+	HashState HashState `bson:"HashState"`
+	// Chunks are the names of the blobs with the bytes up to Offset in order
+	Chunks []string `bson:"Chunks"`
+}
 
-		client, err = mongo.Connect(ctx, clientOptions)
-		if err != nil {
-			return fmt.Errorf("failed to connect to MongoDB: %w", err)
-		}
+// StoredUpload is a resumable upload together with the file it creates.
+type StoredUpload struct {
+	ObjectId primitive.ObjectID `bson:"_id"`
+	StoredAt *time.Time         `bson:"StoredAt"`
+	Upload   Upload             `bson:"Upload"`
+}
 
-		fmt.Println("MongoDB client initialized")
+// StoreUpload stores the file id together with the state of a resumable upload that has not received any bytes yet.
+func StoreUpload(ctx context.Context, collection *mongo.Collection, fileId uuid.UUID, upload Upload) (primitive.ObjectID, error) {
+	if rand.Float64() < ErrorProbabilityFileId {
+		return primitive.NilObjectID, fmt.Errorf("Failed to write to database")
+	}
 
-		if err := client.Ping(ctx, nil); err != nil {
-			return fmt.Errorf("failed to ping MongoDB: %w", err)
-		}
+	objectId := primitive.NewObjectID()
+	document := newFileDocument(ctx, objectId, fileId)
+	upload.Offset = 0
+	upload.LastChunkAt = time.Now().UTC()
+	// an empty array, so that StoreUploadOffset can push the chunks
+	upload.Chunks = []string{}
+	document["Upload"] = upload
 
-		fmt.Println("MongoDB ping successful")
+	_, err := collection.InsertOne(ctx, document)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to insert upload: %w", err)
+	}
+
+	return objectId, nil
+}
+
+func FetchUpload(ctx context.Context, collection *mongo.Collection, fileId uuid.UUID) (StoredUpload, error) {
+	filter := bson.M{"FileId": fileIdValue(fileId), "Upload": bson.M{"$exists": true}}
+
+	var upload StoredUpload
+	err := collection.FindOne(ctx, filter).Decode(&upload)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return StoredUpload{}, ErrUploadNotFound
+	}
+	if err != nil {
+		return StoredUpload{}, fmt.Errorf("failed to fetch upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// StoreUploadOffset moves the offset of the upload forward together with the state of the checksum at this offset and the chunk
+// with the bytes in between. It returns false if the offset is no longer at from, because another request appended to the upload
+// in the meantime, then the chunk is not part of the upload.
+func StoreUploadOffset(ctx context.Context, collection *mongo.Collection, objectId primitive.ObjectID, from int64, to int64, hashState HashState, chunk string) (bool, error) {
+	filter := bson.M{"_id": objectId, "Upload.Offset": from}
+	update := bson.M{
+		"$set": bson.M{
+			"Upload.Offset":      to,
+			"Upload.LastChunkAt": time.Now().UTC(),
+			"Upload.HashState":   hashState,
+		},
+		"$push": bson.M{"Upload.Chunks": chunk},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to store upload offset: %w", err)
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// StoreUploadMediaType stores the media type detected from the first chunk of the upload.
+func StoreUploadMediaType(ctx context.Context, collection *mongo.Collection, objectId primitive.ObjectID, mediaType string, extension string) error {
+	update := bson.M{"$set": bson.M{
+		"Upload.MediaType": mediaType,
+		"Upload.Extension": extension,
+	}}
+
+	_, err := collection.UpdateByID(ctx, objectId, update)
+	if err != nil {
+		return fmt.Errorf("failed to store upload media type: %w", err)
 	}
 
 	return nil
 }
 
-func DisconnectMongoClient() {
-	if client != nil {
-		// Create a new context with timeout for disconnect operation, the application context might be cancelled
-		disconnectCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// ErrFileNotFound is returned if the file does not exist or is not complete yet
+var ErrFileNotFound = errors.New("file not found")
+
+// StoredFile is the metadata of a complete file.
+type StoredFile struct {
+	StoredAt  time.Time `bson:"StoredAt"`
+	Size      int64     `bson:"Size"`
+	MediaType string    `bson:"MediaType"`
+	Extension string    `bson:"Extension"`
+	// Checksum is missing for files stored before the checksum was introduced
+	Checksum *Checksum `bson:"Checksum"`
+}
 
-		defer cancel()
+// FetchStoredFile returns the metadata of the file, an incomplete file is not found.
+func FetchStoredFile(ctx context.Context, collection *mongo.Collection, fileId uuid.UUID) (StoredFile, error) {
+	filter := bson.M{"FileId": fileIdValue(fileId), "StoredAt": bson.M{"$exists": true}}
 
-		if err := client.Disconnect(disconnectCtx); err != nil {
-			fmt.Printf("Failed to disconnect MongoDB client: %v\n", err)
-		} else {
-			fmt.Println("MongoDB client disconnected")
-		}
+	var file StoredFile
+	err := collection.FindOne(ctx, filter).Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return StoredFile{}, ErrFileNotFound
 	}
+	if err != nil {
+		return StoredFile{}, fmt.Errorf("failed to fetch file: %w", err)
+	}
+
+	return file, nil
 }
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+// DownloadHandler serves the bytes of a complete file, a file is not found until its metadata is stored.
+// Range requests and conditional requests are answered by http.ServeContent, the ETag is the SHA-256 of the content.
+func DownloadHandler(collection *mongo.Collection, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fileId, err := uuid.Parse(r.PathValue("fileId"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		file, err := FetchStoredFile(r.Context(), collection, fileId)
+		if errors.Is(err, ErrFileNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.Error("Error fetching file", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, "failed to fetch file", http.StatusInternalServerError)
+			return
+		}
+
+		content, err := store.Open(r.Context(), FileName(fileId))
+		if errors.Is(err, storage.ErrNotFound) {
+			// the cleaner or a delete removed the bytes after the metadata was read
+			slog.Warn("File bytes not found", logging.KeyFileId, fileId)
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.Error("Error opening file", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, "failed to open file", http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+
+		w.Header().Set("Content-Type", file.MediaType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", contentDisposition(file.Extension))
+		if file.Checksum != nil {
+			w.Header().Set("ETag", `"`+hex.EncodeToString(file.Checksum.SHA256)+`"`)
+		}
+		http.ServeContent(w, r, "", file.StoredAt, content)
+	}
+}
+
+// contentDisposition uses a random file name, so that the file name contains no personal information or internal identifiers.
+func contentDisposition(extension string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": uuid.NewString() + extension})
+}
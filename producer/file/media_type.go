@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLength is the number of bytes http.DetectContentType considers
+const sniffLength = 512
+
+var (
+	// ErrMediaTypeNotAllowed is returned if the media type of the content is not allowed
+	ErrMediaTypeNotAllowed = errors.New("media type is not allowed")
+	// ErrMediaTypeMismatch is returned if the content does not match the declared media type
+	ErrMediaTypeMismatch = errors.New("content does not match the declared media type")
+)
+
+// canonicalExtensions maps the media types http.DetectContentType detects, and common refinements of text/plain,
+// to the extension a file of this type is stored with
+var canonicalExtensions = map[string]string{
+	"application/octet-stream":      ".bin",
+	"application/ogg":               ".ogg",
+	"application/pdf":               ".pdf",
+	"application/postscript":        ".ps",
+	"application/vnd.ms-fontobject": ".eot",
+	"application/wasm":              ".wasm",
+	"application/x-gzip":            ".gz",
+	"application/x-rar-compressed":  ".rar",
+	"application/zip":               ".zip",
+	"audio/aiff":                    ".aiff",
+	"audio/basic":                   ".au",
+	"audio/midi":                    ".mid",
+	"audio/mpeg":                    ".mp3",
+	"audio/wave":                    ".wav",
+	"font/collection":               ".ttc",
+	"font/otf":                      ".otf",
+	"font/ttf":                      ".ttf",
+	"font/woff":                     ".woff",
+	"font/woff2":                    ".woff2",
+	"image/avif":                    ".avif",
+	"image/bmp":                     ".bmp",
+	"image/gif":                     ".gif",
+	"image/jpeg":                    ".jpg",
+	"image/png":                     ".png",
+	"image/webp":                    ".webp",
+	"image/x-icon":                  ".ico",
+	"text/html":                     ".html",
+	"text/plain":                    ".txt",
+	"text/xml":                      ".xml",
+	"video/avi":                     ".avi",
+	"video/mp4":                     ".mp4",
+	"video/webm":                    ".webm",
+}
+
+// SniffContent reads the first bytes of the content for DetectMediaType. The returned reader still yields the complete content.
+func SniffContent(content io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, fmt.Errorf("%w: %w", ErrReadContent, err)
+	}
+
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), content), nil
+}
+
+// DetectMediaType detects the media type from the magic numbers at the beginning of the content and checks it against the media type
+// and the extension the client declared. The declared type is only used to refine a detected type that is generic, e.g. text/csv
+// for text/plain. It returns the media type and the extension the file is stored with.
+func (c MediaTypeConfig) DetectMediaType(head []byte, declaredType string, declaredExtension string) (string, string, error) {
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to detect media type: %w", err)
+	}
+
+	mediaType := detected
+	switch {
+	case declaredType == "" || declaredType == defaultMediaType || declaredType == detected:
+	case refines(detected, declaredType):
+		mediaType = declaredType
+	case c.RejectMismatch:
+		return "", "", fmt.Errorf("%w: declared %s, detected %s", ErrMediaTypeMismatch, declaredType, detected)
+	}
+
+	if !c.Allows(mediaType) {
+		return "", "", fmt.Errorf("%w: %s", ErrMediaTypeNotAllowed, mediaType)
+	}
+
+	return mediaType, extensionOfType(mediaType, declaredExtension), nil
+}
+
+// refines returns true if the declared type is a more specific variant of the generic detected type.
+func refines(detected string, declared string) bool {
+	switch detected {
+	case "text/plain":
+		return strings.HasPrefix(declared, "text/") || declared == "application/json"
+	case defaultMediaType:
+		// binary content without magic number, a type with a known magic number would have been detected
+		_, detectable := canonicalExtensions[declared]
+		return !detectable && !strings.HasPrefix(declared, "text/")
+	default:
+		return false
+	}
+}
+
+// Allows returns true if the media type can be stored, a type like image/* allows all subtypes and */* allows every type.
+func (c MediaTypeConfig) Allows(mediaType string) bool {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	for _, allowed := range c.Allowed {
+		if allowed == mediaType || allowed == "*/*" || allowed == mainType+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionOfType returns the canonical extension of the media type. The declared extension is only kept
+// for a media type without canonical extension, and only if it belongs to this media type.
+func extensionOfType(mediaType string, declaredExtension string) string {
+	if extension, ok := canonicalExtensions[mediaType]; ok {
+		return extension
+	}
+
+	if declaredExtension != "" {
+		if declared, _, err := mime.ParseMediaType(mime.TypeByExtension(declaredExtension)); err == nil && declared == mediaType {
+			return declaredExtension
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+var (
+	ErrorProbabilityUserPrMetworkAborted float64 = 0.05
+)
+
+var (
+	minDelay = 2
+	maxDelay = 5
+)
+
+// SimulateStoreFile is the load generator of the producer, it stores a file with random text every few seconds.
+func SimulateStoreFile(ctx context.Context, db mongodb.Connection, store storage.BlobStore, options Options) error {
+	slog.Info("Storing files")
+
+	collection := FileCollection(db)
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Context cancelled, storing files stopped")
+			return ctx.Err()
+		case <-time.After(CreateJitteredDelay()):
+			err := StoreRandomFile(ctx, collection, store, options)
+			if err != nil && (os.IsTimeout(err) || err == context.Canceled || err == context.DeadlineExceeded) {
+				return err
+			}
+			if err != nil {
+				slog.Error("Error storing file", logging.Error(err))
+			}
+		}
+	}
+}
+
+func CreateJitteredDelay() time.Duration {
+	jitter := time.Duration(rand.IntN(maxDelay-minDelay)+minDelay) * time.Second
+	slog.Debug("Jittered delay", "delay", jitter)
+	return jitter
+}
+
+// StoreRandomFile stores a text file of random size that is uploaded in a few chunks.
+func StoreRandomFile(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, options Options) error {
+	_, err := StoreUploadedFile(ctx, collection, store, options, NewRandomText(), "text/plain", ".txt")
+	return err
+}
+
+// DisableSimulatedFailures stops the random errors that mimic user aborts, network, file write and database failures.
+func DisableSimulatedFailures() {
+	ErrorProbabilityFileId = 0
+	ErrorProbabilityMetadata = 0
+	ErrorProbabilityFileCreate = 0
+	ErrorProbabilityFileClose = 0
+	ErrorProbabilityFileWriteByte = 0
+	ErrorProbabilityUserPrMetworkAborted = 0
+}
+
+// randomText is the content of a simulated upload. It is read in randomly sized chunks, each of them can be aborted by the user.
+type randomText struct {
+	remainingChunks int
+}
+
+func NewRandomText() io.Reader {
+	return &randomText{remainingChunks: rand.IntN(4) + 2}
+}
+
+func (r *randomText) Read(p []byte) (int, error) {
+	if r.remainingChunks == 0 {
+		return 0, io.EOF
+	}
+	if rand.Float64() < ErrorProbabilityUserPrMetworkAborted {
+		return 0, fmt.Errorf("Stream was aborted")
+	}
+	r.remainingChunks--
+
+	chunkSize := rand.Uint64N(1024) + 512 // Random chunk size between 512 bytes and 1536 bytes
+	return copy(p, GenerateRandomText(chunkSize)), nil
+}
+
+func GenerateRandomText(chunkSize uint64) []byte {
+	letters := []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ")
+	randomText := make([]byte, chunkSize)
+	for i := range randomText {
+		randomText[i] = letters[rand.IntN(len(letters))]
+	}
+	return randomText
+}
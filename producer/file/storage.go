@@ -1,121 +1,188 @@
 package file
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math/rand/v2"
-	"os"
-	"path"
 
 	"github.com/google/uuid"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
 )
 
 var (
-	ErrorProbabilityFolderCreate         float64 = 0.01
-	ErrorProbabilityFileCreate           float64 = 0.01
-	ErrorProbabilityFileClose            float64 = 0.01
-	ErrorProbabilityFileWriteByte        float64 = 0.02
-	ErrorProbabilityUserPrMetworkAborted float64 = 0.05
+	ErrorProbabilityFileCreate    float64 = 0.01
+	ErrorProbabilityFileClose     float64 = 0.01
+	ErrorProbabilityFileWriteByte float64 = 0.02
 )
 
-const (
-	StoragePath = "storage"
-)
+// ErrReadContent is returned if the content of the file could not be read, e.g. the upload was aborted
+var ErrReadContent = errors.New("failed to read content")
+
+// chunkSize is the size of the buffer the content is copied with
+const chunkSize = 32 * 1024
+
+// FileName returns the name of the blob with the bytes of the file.
+func FileName(fileId uuid.UUID) string {
+	return fileId.String() + "/" + fileId.String()
+}
 
-func StoreFileBytes(fileId uuid.UUID) (uint64, string, error) {
-	writeCloser, err := CreateFileAndFolder(fileId)
+// chunkName returns the name of the blob of a chunk of a resumable upload, the offset is padded so that the chunks are listed in order.
+// Each attempt to append at an offset writes its own blob, the upload records the blob of the attempt that moved the offset.
+func chunkName(fileId uuid.UUID, offset int64) string {
+	return fmt.Sprintf("%s/chunks/%020d-%s", fileId, offset, uuid.NewString())
+}
+
+// StoreFileBytes streams the content into the storage and returns the number of bytes written and the checksum of the content.
+func StoreFileBytes(ctx context.Context, store storage.BlobStore, fileId uuid.UUID, content io.Reader, contentHash *ContentHash) (uint64, Checksum, error) {
+	writer, err := CreateFile(ctx, store, FileName(fileId))
 	if err != nil {
-		return 0, "", err
+		return 0, Checksum{}, err
 	}
 
-	fileSize, mediaType, err := WriteChunk(writeCloser)
+	fileSize, err := WriteChunks(hashingWriter{writer: writer, hash: contentHash}, content)
 	if err != nil {
-		return 0, "", err
+		writer.Abort(err)
+		return 0, Checksum{}, err
 	}
 
-	err = CloseFile(writeCloser)
+	err = CloseFile(writer)
 	if err != nil {
-		return 0, "", err
+		return 0, Checksum{}, err
 	}
 
-	return fileSize, mediaType, nil
+	return fileSize, contentHash.Checksum(), nil
 }
 
-func CreateFileAndFolder(fileId uuid.UUID) (io.WriteCloser, error) {
-	fileFolder := path.Join(StoragePath, fileId.String())
-	fileLocation := path.Join(fileFolder, fileId.String())
+// StoreChunk stores the content as a new chunk of a resumable upload at offset and returns its name and the number of bytes stored.
+// The bytes received before the content could not be read are stored anyway, so that the client can resume after them.
+// The stored bytes are added to contentHash.
+func StoreChunk(ctx context.Context, store storage.BlobStore, fileId uuid.UUID, offset int64, content io.Reader, contentHash *ContentHash) (string, uint64, error) {
+	name := chunkName(fileId, offset)
+	writer, err := CreateFile(ctx, store, name)
+	if err != nil {
+		return "", 0, err
+	}
 
-	err := CreateFolder(fileFolder)
+	written, err := WriteChunks(hashingWriter{writer: writer, hash: contentHash}, content)
+	if err != nil && (written == 0 || !errors.Is(err, ErrReadContent)) {
+		writer.Abort(err)
+		return "", 0, err
+	}
+
+	if closeErr := CloseFile(writer); closeErr != nil {
+		return "", 0, errors.Join(err, closeErr)
+	}
+	return name, written, err
+}
+
+// JoinChunks stores the chunks of a resumable upload as the file. The chunks follow each other, each one starts at the end of the previous one.
+func JoinChunks(ctx context.Context, store storage.BlobStore, fileId uuid.UUID, chunks []string, length int64) error {
+	writer, err := CreateFile(ctx, store, FileName(fileId))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	wc, err := CreateFile(fileLocation)
-	return wc, err
+	var offset int64
+	for _, chunk := range chunks {
+		written, err := copyChunk(ctx, store, writer, chunk)
+		if err == nil && written == 0 {
+			err = fmt.Errorf("chunk at offset %d is empty", offset)
+		}
+		if err != nil {
+			writer.Abort(err)
+			return err
+		}
+		offset += written
+	}
+	if offset != length {
+		err := fmt.Errorf("chunks contain %d bytes instead of %d", offset, length)
+		writer.Abort(err)
+		return err
+	}
+
+	return CloseFile(writer)
 }
 
-func CreateFolder(fileFolder string) error {
-	if rand.Float64() < ErrorProbabilityFolderCreate {
-		return fmt.Errorf("Failed to create folder")
+func copyChunk(ctx context.Context, store storage.BlobStore, writer io.Writer, name string) (int64, error) {
+	chunk, err := store.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer chunk.Close()
+
+	written, err := io.Copy(writer, chunk)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to copy chunk %s: %w", name, err)
+	}
+	return written, nil
+}
+
+// DeleteChunks deletes the chunks of a completed resumable upload, also those of attempts that lost the race for their offset.
+// A chunk that could not be deleted is only logged, the file is complete anyway.
+func DeleteChunks(ctx context.Context, store storage.BlobStore, fileId uuid.UUID) {
+	chunks, err := store.List(ctx, fileId.String()+"/chunks/")
+	if err != nil {
+		slog.Warn("Failed to list chunks", logging.KeyFileId, fileId, logging.Error(err))
+		return
+	}
+
+	for _, chunk := range chunks {
+		if err := store.Delete(ctx, chunk.Name); err != nil {
+			slog.Warn("Failed to delete chunk", logging.KeyFileId, fileId, "chunk", chunk.Name, logging.Error(err))
+		}
 	}
-	err := os.MkdirAll(fileFolder, os.ModePerm)
-	return err
 }
 
-func CreateFile(fileLocation string) (io.WriteCloser, error) {
+func CreateFile(ctx context.Context, store storage.BlobStore, name string) (storage.BlobWriter, error) {
 	if rand.Float64() < ErrorProbabilityFileCreate {
 		return nil, fmt.Errorf("Failed to create file")
 	}
 
-	writer, err := os.Create(fileLocation)
-	return writer, err
+	return store.Create(ctx, name)
 }
 
-// WriteChunk simulates writing a file in randomly sized chunks, introducing random errors to mimic
-// user aborts, network or file write failures. It returns the total file size written, the media type of the file,
-// and an error if any failure occurs during the process.
+// WriteChunks copies the content chunk by chunk into the file, introducing random errors to mimic file write failures.
+// A failure to read the content is wrapped in ErrReadContent, so that it can be told apart from a failure of the storage.
 //
 // Returns:
-//   - uint64: The total size of the file written in bytes.
-//   - string: The media type of the file
-//   - error: An error if the stream is aborted or a file write fails; otherwise, nil.
-func WriteChunk(fileWriter io.WriteCloser) (uint64, string, error) {
+//   - uint64: The total size of the file written in bytes, on error the bytes written before the failure.
+//   - error: An error if the content can not be read or a file write fails; otherwise, nil.
+func WriteChunks(fileWriter io.Writer, content io.Reader) (uint64, error) {
 	var fileSize uint64 = 0
-	numberOfChunks := rand.IntN(4) + 2
-	for i := 0; i < numberOfChunks; i++ {
-		if rand.Float64() < ErrorProbabilityUserPrMetworkAborted {
-			return 0, "", fmt.Errorf("Stream was aborted")
+	chunk := make([]byte, chunkSize)
+	for {
+		n, readErr := content.Read(chunk)
+		if n > 0 {
+			if rand.Float64() < ErrorProbabilityFileWriteByte {
+				return fileSize, fmt.Errorf("Failed to write file bytes")
+			}
+			written, err := fileWriter.Write(chunk[:n])
+			fileSize += uint64(written)
+			if err != nil {
+				return fileSize, fmt.Errorf("Failed to write file bytes: %w", err)
+			}
 		}
-		chunkSize := rand.Uint64N(1024) + 512 // Random chunk size between 512 bytes and 1536 bytes
-		fileSize += chunkSize
-		if rand.Float64() < ErrorProbabilityFileWriteByte {
-			return 0, "", fmt.Errorf("Failed to write file bytes")
+		if readErr == io.EOF {
+			return fileSize, nil
 		}
-
-		randomText := GenerateRandomText(chunkSize)
-		_, err := fileWriter.Write(randomText)
-		if err != nil {
-			return 0, "", fmt.Errorf("Failed to write file bytes: %w", err)
+		if readErr != nil {
+			return fileSize, fmt.Errorf("%w: %w", ErrReadContent, readErr)
 		}
 	}
-
-	return fileSize, "text/plain", nil
-}
-
-func GenerateRandomText(chunkSize uint64) []byte {
-	letters := []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ")
-	randomText := make([]byte, chunkSize)
-	for i := range randomText {
-		randomText[i] = letters[rand.IntN(len(letters))]
-	}
-	return randomText
 }
 
-func CloseFile(fileCloser io.WriteCloser) error {
+// CloseFile stores the file, a failure discards it.
+func CloseFile(writer storage.BlobWriter) error {
 	if rand.Float64() < ErrorProbabilityFileClose {
-		return fmt.Errorf("Failed to write to database")
+		err := fmt.Errorf("Failed to close file")
+		writer.Abort(err)
+		return err
 	}
 
-	closeErr := fileCloser.Close()
-	return closeErr
+	return writer.Close()
 }
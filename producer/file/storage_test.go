@@ -0,0 +1,67 @@
+package file
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+// Two producers can append at the same offset, only the chunk recorded with the offset belongs to the file.
+func TestJoinChunksJoinsRecordedChunks(t *testing.T) {
+	DisableSimulatedFailures()
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+	fileId := uuid.New()
+
+	first := storeChunk(t, store, fileId, 0, "first ")
+	storeChunk(t, store, fileId, 6, "lost chunk")
+	second := storeChunk(t, store, fileId, 6, "chunk")
+
+	if err := JoinChunks(ctx, store, fileId, []string{first, second}, 11); err != nil {
+		t.Fatalf("JoinChunks failed: %v", err)
+	}
+
+	file, err := store.Open(ctx, FileName(fileId))
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if string(content) != "first chunk" {
+		t.Fatalf("file contains %q, want the recorded chunks", content)
+	}
+}
+
+func TestJoinChunksFailsOnMissingBytes(t *testing.T) {
+	DisableSimulatedFailures()
+	store := storage.NewLocalStore(t.TempDir())
+	fileId := uuid.New()
+
+	first := storeChunk(t, store, fileId, 0, "first ")
+
+	if err := JoinChunks(context.Background(), store, fileId, []string{first}, 11); err == nil {
+		t.Fatal("JoinChunks succeeded, want an error")
+	}
+}
+
+func storeChunk(t *testing.T, store storage.BlobStore, fileId uuid.UUID, offset int64, content string) string {
+	t.Helper()
+
+	name, written, err := StoreChunk(context.Background(), store, fileId, offset, strings.NewReader(content), NewContentHash(false))
+	if err != nil {
+		t.Fatalf("StoreChunk failed: %v", err)
+	}
+	if written != uint64(len(content)) {
+		t.Fatalf("StoreChunk wrote %d bytes, want %d", written, len(content))
+	}
+
+	return name
+}
@@ -3,64 +3,56 @@ package file
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"os"
-	"time"
+	"io"
+	"log/slog"
 
 	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
-var (
-	minDelay = 2
-	maxDelay = 5
-)
-
-func SimulateStoreFile(ctx context.Context) error {
-	fmt.Println("Storing File...")
+var tracer = otel.Tracer("github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/producer/file")
 
-	if err := InitializeMongoClient(ctx); err != nil {
-		return err
+// StoreUploadedFile detects the media type of the content before the file is stored, a file of a media type that is not allowed is not stored at all.
+func StoreUploadedFile(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, options Options, content io.Reader, declaredType string, declaredExtension string) (uuid.UUID, error) {
+	head, content, err := SniffContent(content)
+	if err != nil {
+		return uuid.Nil, err
 	}
-	defer DisconnectMongoClient()
-
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Context cancelled, storing File stopped")
-			return ctx.Err()
-		case <-time.After(CreateJitteredDelay()):
-			err := StoreFile(ctx)
-			if err != nil && (os.IsTimeout(err) || err == context.Canceled || err == context.DeadlineExceeded) {
-				return err
-			}
-			if err != nil {
-				fmt.Printf("Error storing file: %v", err)
-			} else {
-				fmt.Println("File stored successfully")
-			}
-		}
+	mediaType, extension, err := options.MediaTypes.DetectMediaType(head, declaredType, declaredExtension)
+	if err != nil {
+		return uuid.Nil, err
 	}
-}
 
-func CreateJitteredDelay() time.Duration {
-	jitter := time.Duration(rand.Intn(maxDelay-minDelay)+minDelay) * time.Second
-	fmt.Printf("Jittered delay: %v\n", jitter)
-	return jitter
+	return StoreFile(ctx, collection, store, options, content, mediaType, extension)
 }
 
-func StoreFile(ctx context.Context) error {
-	fileId := uuid.New()
-	objectId, err := StoreFileId(ctx, fileId)
+// StoreFile stores the file id, the bytes of the content and the metadata, in this order. A file is complete once its metadata is stored,
+// an incomplete file is removed by the cleaner. StoreFile starts the trace of the file, the miner and the consumer continue it.
+func StoreFile(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, options Options, content io.Reader, mediaType string, extension string) (fileId uuid.UUID, err error) {
+	fileId = uuid.New()
+	ctx, span := tracer.Start(ctx, "StoreFile", trace.WithAttributes(attribute.String("file.id", fileId.String())))
+	defer func() { tracing.End(span, err) }()
+
+	objectId, err := StoreFileId(ctx, collection, fileId)
 	if err != nil {
-		return fmt.Errorf("Error storing file ID: %w for %v\n", err, fileId)
+		return fileId, fmt.Errorf("Error storing file ID: %w for %v", err, fileId)
 	}
-	size, mediaType, err := StoreFileBytes(fileId)
+	size, checksum, err := StoreFileBytes(ctx, store, fileId, content, NewContentHash(options.ChecksumCRC32C))
 	if err != nil {
-		return fmt.Errorf("Error storing file bytes: %w for %v\n", err, fileId)
+		return fileId, fmt.Errorf("Error storing file bytes: %w for %v", err, fileId)
 	}
-	err = StoreFileMetadata(ctx, objectId, size, mediaType)
+	err = StoreFileMetadata(ctx, collection, objectId, size, mediaType, extension, checksum)
 	if err != nil {
-		return fmt.Errorf("Error storing file metadata: %w for %v\n", err, fileId)
+		return fileId, fmt.Errorf("Error storing file metadata: %w for %v", err, fileId)
 	}
-	return nil
+
+	slog.Info("File stored", logging.KeyFileId, fileId, "size", size, "media_type", mediaType)
+	return fileId, nil
 }
@@ -0,0 +1,371 @@
+package file
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
+)
+
+// Headers of the tus protocol for resumable uploads, see https://tus.io/protocols/resumable-upload
+const (
+	tusVersion            = "1.0.0"
+	tusResumableHeader    = "Tus-Resumable"
+	tusVersionHeader      = "Tus-Version"
+	tusExtensionHeader    = "Tus-Extension"
+	tusMaxSizeHeader      = "Tus-Max-Size"
+	uploadLengthHeader    = "Upload-Length"
+	uploadOffsetHeader    = "Upload-Offset"
+	uploadMetadataHeader  = "Upload-Metadata"
+	offsetOctetStreamType = "application/offset+octet-stream"
+)
+
+// uploadLocks holds the file ids of the uploads a PATCH request is appending to. It answers a concurrent request to the same producer
+// early, requests to different producers are told apart by the compare-and-set of the offset.
+var uploadLocks sync.Map
+
+// IsTusRequest returns true if the request follows the tus protocol instead of being a plain upload.
+func IsTusRequest(r *http.Request) bool {
+	return r.Header.Get(tusResumableHeader) != ""
+}
+
+// TusOptionsHandler answers OPTIONS /files with the capabilities of the server.
+func TusOptionsHandler(options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(tusResumableHeader, tusVersion)
+		w.Header().Set(tusVersionHeader, tusVersion)
+		w.Header().Set(tusExtensionHeader, "creation")
+		w.Header().Set(tusMaxSizeHeader, strconv.FormatInt(options.MaxUploadSize, 10))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TusCreateHandler creates a resumable upload of Upload-Length bytes. The file is complete when the last byte is appended.
+func TusCreateHandler(collection *mongo.Collection, store storage.BlobStore, options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptTusVersion(w, r) {
+			return
+		}
+
+		length, err := strconv.ParseInt(r.Header.Get(uploadLengthHeader), 10, 64)
+		if err != nil || length < 0 {
+			http.Error(w, "invalid "+uploadLengthHeader, http.StatusBadRequest)
+			return
+		}
+		if length > options.MaxUploadSize {
+			http.Error(w, ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		metadata, err := parseUploadMetadata(r.Header.Get(uploadMetadataHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mediaType, err := parseMediaType(metadata["filetype"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if mediaType != defaultMediaType && !options.MediaTypes.Allows(mediaType) {
+			http.Error(w, fmt.Sprintf("%s: %s", ErrMediaTypeNotAllowed, mediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		upload := Upload{
+			Length:    length,
+			MediaType: mediaType,
+			Extension: extensionOf(metadata["filename"]),
+		}
+		fileId, err := CreateUpload(r.Context(), collection, store, options, upload)
+		if errors.Is(err, ErrMediaTypeNotAllowed) || errors.Is(err, ErrMediaTypeMismatch) {
+			slog.Info("Upload rejected", logging.Error(err))
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			slog.Error("Error creating upload", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, "failed to create upload", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", "/files/"+fileId.String())
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// TusHeadHandler returns the offset of a resumable upload, the client continues the upload from there.
+func TusHeadHandler(collection *mongo.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptTusVersion(w, r) {
+			return
+		}
+
+		upload, ok := fetchUpload(w, r, collection)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Upload.Offset, 10))
+		w.Header().Set(uploadLengthHeader, strconv.FormatInt(upload.Upload.Length, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// TusPatchHandler appends the body to the upload at Upload-Offset, which must be the offset of the upload.
+// The bytes received before an aborted request are kept, so that the client can resume from the returned offset.
+func TusPatchHandler(collection *mongo.Collection, store storage.BlobStore, options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !acceptTusVersion(w, r) {
+			return
+		}
+		if r.Header.Get("Content-Type") != offsetOctetStreamType {
+			http.Error(w, "content type must be "+offsetOctetStreamType, http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(r.Header.Get(uploadOffsetHeader), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid "+uploadOffsetHeader, http.StatusBadRequest)
+			return
+		}
+
+		fileId := r.PathValue("fileId")
+		if _, locked := uploadLocks.LoadOrStore(fileId, struct{}{}); locked {
+			http.Error(w, "upload is locked by another request", http.StatusLocked)
+			return
+		}
+		defer uploadLocks.Delete(fileId)
+
+		upload, ok := fetchUpload(w, r, collection)
+		if !ok {
+			return
+		}
+		if offset != upload.Upload.Offset {
+			w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Upload.Offset, 10))
+			http.Error(w, "offset does not match the offset of the upload", http.StatusConflict)
+			return
+		}
+
+		newOffset, err := AppendUpload(r.Context(), collection, store, options, uuid.MustParse(fileId), upload, r.Body)
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(newOffset, 10))
+		switch {
+		case errors.Is(err, ErrMediaTypeNotAllowed) || errors.Is(err, ErrMediaTypeMismatch):
+			slog.Info("Upload rejected", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		case errors.Is(err, ErrFileTooLarge):
+			http.Error(w, "body exceeds "+uploadLengthHeader, http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, ErrUploadOffsetChanged):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, ErrReadContent):
+			slog.Info("Upload chunk aborted", logging.KeyFileId, fileId, "offset", newOffset, logging.Error(err))
+			http.Error(w, "failed to read chunk", http.StatusBadRequest)
+			return
+		case err != nil:
+			slog.Error("Error appending to upload", logging.KeyFileId, fileId, "offset", newOffset, logging.Error(err))
+			http.Error(w, "failed to append to upload", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ErrUploadOffsetChanged is returned if another request appended to the upload at the same time
+var ErrUploadOffsetChanged = errors.New("offset of the upload changed")
+
+// CreateUpload stores the file id, like StoreFile the upload starts the trace of the file. An empty upload is complete right away,
+// its media type is rejected before the upload is stored.
+func CreateUpload(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, options Options, upload Upload) (fileId uuid.UUID, err error) {
+	fileId = uuid.New()
+	ctx, span := tracer.Start(ctx, "CreateUpload", trace.WithAttributes(
+		attribute.String("file.id", fileId.String()),
+		attribute.Int64("upload.length", upload.Length),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if upload.Length == 0 {
+		// an empty file has no chunk to detect the media type from, it is validated before anything is stored
+		upload.MediaType, upload.Extension, err = options.MediaTypes.DetectMediaType(nil, upload.MediaType, upload.Extension)
+		if err != nil {
+			return fileId, err
+		}
+	}
+
+	upload.HashState, err = NewContentHash(options.ChecksumCRC32C).State()
+	if err != nil {
+		return fileId, err
+	}
+	objectId, err := StoreUpload(ctx, collection, fileId, upload)
+	if err != nil {
+		return fileId, fmt.Errorf("Error storing upload: %w for %v", err, fileId)
+	}
+
+	slog.Info("Upload created", logging.KeyFileId, fileId, "length", upload.Length, "media_type", upload.MediaType)
+	if upload.Length == 0 {
+		return fileId, completeUpload(ctx, collection, store, fileId, StoredUpload{ObjectId: objectId, Upload: upload})
+	}
+	return fileId, nil
+}
+
+// AppendUpload stores the content as the next chunk and stores the new offset, also if the content could not be read completely.
+// The file is completed with its metadata when the last byte arrived. It returns the offset of the upload.
+func AppendUpload(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, options Options, fileId uuid.UUID, upload StoredUpload, content io.Reader) (offset int64, err error) {
+	ctx, span := tracer.Start(ctx, "AppendUpload", trace.WithAttributes(
+		attribute.String("file.id", fileId.String()),
+		attribute.Int64("upload.offset", upload.Upload.Offset),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	offset = upload.Upload.Offset
+	if upload.StoredAt != nil {
+		// the last chunk was already appended
+		return offset, nil
+	}
+
+	if offset == 0 {
+		// the media type is detected from the first chunk, so that a file of a media type that is not allowed is rejected early
+		var head []byte
+		head, content, err = SniffContent(content)
+		if err != nil {
+			return offset, err
+		}
+		mediaType, extension, err := options.MediaTypes.DetectMediaType(head, upload.Upload.MediaType, upload.Upload.Extension)
+		if err != nil {
+			return offset, err
+		}
+		if err := StoreUploadMediaType(ctx, collection, upload.ObjectId, mediaType, extension); err != nil {
+			return offset, err
+		}
+		upload.Upload.MediaType = mediaType
+		upload.Upload.Extension = extension
+	}
+
+	contentHash, err := RestoreContentHash(upload.Upload.HashState)
+	if err != nil {
+		return offset, err
+	}
+	// the client is gone if the content could not be read, the chunk and the offset are stored anyway
+	storeCtx := context.WithoutCancel(ctx)
+	chunk, written, appendErr := StoreChunk(storeCtx, store, fileId, offset, newSizeLimitedReader(content, upload.Upload.Length-offset), contentHash)
+	if written > 0 {
+		hashState, err := contentHash.State()
+		if err != nil {
+			return offset, errors.Join(appendErr, err)
+		}
+		// the chunk becomes part of the upload only together with the offset, a request of another producer can append at the same offset
+		stored, err := StoreUploadOffset(storeCtx, collection, upload.ObjectId, offset, offset+int64(written), hashState, chunk)
+		if err != nil {
+			return offset, errors.Join(appendErr, err)
+		}
+		if !stored {
+			if err := store.Delete(storeCtx, chunk); err != nil {
+				slog.Warn("Failed to delete chunk of a concurrent append", logging.KeyFileId, fileId, "chunk", chunk, logging.Error(err))
+			}
+			return offset, ErrUploadOffsetChanged
+		}
+		offset += int64(written)
+		upload.Upload.HashState = hashState
+		upload.Upload.Chunks = append(upload.Upload.Chunks, chunk)
+		slog.Debug("Upload chunk appended", logging.KeyFileId, fileId, "offset", offset, "length", upload.Upload.Length)
+	}
+	if appendErr != nil {
+		return offset, appendErr
+	}
+
+	if offset == upload.Upload.Length {
+		return offset, completeUpload(ctx, collection, store, fileId, upload)
+	}
+	return offset, nil
+}
+
+// completeUpload joins the chunks to the file and stores the metadata of the file, which makes the miner publish it.
+// The checksum is the hash state after the last chunk. The chunks are deleted after the file is complete, so that a failed completion can be repeated.
+func completeUpload(ctx context.Context, collection *mongo.Collection, store storage.BlobStore, fileId uuid.UUID, upload StoredUpload) error {
+	contentHash, err := RestoreContentHash(upload.Upload.HashState)
+	if err != nil {
+		return err
+	}
+
+	err = JoinChunks(ctx, store, fileId, upload.Upload.Chunks, upload.Upload.Length)
+	if err != nil {
+		return fmt.Errorf("Error joining chunks: %w for %v", err, fileId)
+	}
+
+	err = StoreFileMetadata(ctx, collection, upload.ObjectId, uint64(upload.Upload.Length), upload.Upload.MediaType, upload.Upload.Extension, contentHash.Checksum())
+	if err != nil {
+		return fmt.Errorf("Error storing file metadata: %w for %v", err, fileId)
+	}
+
+	DeleteChunks(ctx, store, fileId)
+	slog.Info("File stored", logging.KeyFileId, fileId, "size", upload.Upload.Length, "media_type", upload.Upload.MediaType)
+	return nil
+}
+
+func acceptTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set(tusResumableHeader, tusVersion)
+	if r.Header.Get(tusResumableHeader) != tusVersion {
+		w.Header().Set(tusVersionHeader, tusVersion)
+		http.Error(w, "tus version is not supported", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// fetchUpload answers the request if the upload does not exist.
+func fetchUpload(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) (StoredUpload, bool) {
+	fileId, err := uuid.Parse(r.PathValue("fileId"))
+	if err != nil {
+		http.NotFound(w, r)
+		return StoredUpload{}, false
+	}
+
+	upload, err := FetchUpload(r.Context(), collection, fileId)
+	if errors.Is(err, ErrUploadNotFound) {
+		http.NotFound(w, r)
+		return StoredUpload{}, false
+	}
+	if err != nil {
+		slog.Error("Error fetching upload", logging.KeyFileId, fileId, logging.Error(err))
+		http.Error(w, "failed to fetch upload", http.StatusInternalServerError)
+		return StoredUpload{}, false
+	}
+	return upload, true
+}
+
+// parseUploadMetadata decodes the comma separated pairs of key and base64 encoded value of Upload-Metadata.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of key %s: %w", uploadMetadataHeader, key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
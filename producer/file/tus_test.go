@@ -0,0 +1,34 @@
+package file
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// An empty upload is complete right away, its declared media type is checked before the upload is stored.
+// The handler has no collection and no store, storing the upload would panic.
+func TestTusCreateHandlerRejectsMediaTypeOfEmptyUpload(t *testing.T) {
+	options := DefaultConfig().Options()
+	tests := map[string]string{
+		"declared type does not match the empty content": "image/png",
+		"declared type is not allowed":                   "application/zip",
+	}
+
+	for name, declaredType := range tests {
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/files", nil)
+			request.Header.Set(tusResumableHeader, tusVersion)
+			request.Header.Set(uploadLengthHeader, "0")
+			request.Header.Set(uploadMetadataHeader, "filetype "+base64.StdEncoding.EncodeToString([]byte(declaredType)))
+			response := httptest.NewRecorder()
+
+			TusCreateHandler(nil, nil, options)(response, request)
+
+			if response.Code != http.StatusUnsupportedMediaType {
+				t.Fatalf("status is %d (%s), want %d", response.Code, response.Body, http.StatusUnsupportedMediaType)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+)
+
+const (
+	// multipartField is the form field of the file in a multipart upload
+	multipartField   = "file"
+	defaultMediaType = "application/octet-stream"
+)
+
+// ErrFileTooLarge is returned if the content exceeds the maximum upload size
+var ErrFileTooLarge = errors.New("file exceeds the maximum upload size")
+
+type uploadResponse struct {
+	FileId string `json:"fileId"`
+}
+
+// UploadHandler stores the file of POST /files. The file is the raw body of the request or the field "file" of a multipart form,
+// it is streamed into the storage without being buffered. The client can declare the media type with the Content-Type of the request
+// or the multipart field, and the file name with the Content-Disposition header of a raw upload.
+func UploadHandler(collection *mongo.Collection, store storage.BlobStore, options Options) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > options.MaxUploadSize {
+			http.Error(w, ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		content, mediaType, extension, err := uploadContent(r)
+		if err != nil {
+			slog.Info("Upload rejected", logging.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fileId, err := StoreUploadedFile(r.Context(), collection, store, options, newSizeLimitedReader(content, options.MaxUploadSize), mediaType, extension)
+		switch {
+		case errors.Is(err, ErrMediaTypeNotAllowed) || errors.Is(err, ErrMediaTypeMismatch):
+			slog.Info("Upload rejected", logging.Error(err))
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		case errors.Is(err, ErrFileTooLarge):
+			slog.Info("Upload rejected", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, ErrReadContent):
+			// the client aborted the upload or sent a malformed body, the cleaner removes the incomplete file
+			slog.Info("Upload aborted", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, "failed to read file", http.StatusBadRequest)
+			return
+		case err != nil:
+			slog.Error("Error storing file", logging.KeyFileId, fileId, logging.Error(err))
+			http.Error(w, "failed to store file", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/files/"+fileId.String())
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(uploadResponse{FileId: fileId.String()})
+	}
+}
+
+// uploadContent returns the content of the file with the media type and the extension the client declared.
+func uploadContent(r *http.Request) (io.Reader, string, string, error) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		mediaType, err := parseMediaType(contentType)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return r.Body, mediaType, extensionOf(rawFileName(r)), nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid multipart form: %w", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", "", fmt.Errorf("multipart form has no field %q", multipartField)
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid multipart form: %w", err)
+		}
+		if part.FormName() != multipartField {
+			continue
+		}
+
+		mediaType, err := parseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, "", "", err
+		}
+		return part, mediaType, extensionOf(part.FileName()), nil
+	}
+}
+
+// parseMediaType removes the parameters of the content type, a missing content type is stored as binary data.
+func parseMediaType(contentType string) (string, error) {
+	if contentType == "" {
+		return defaultMediaType, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	return mediaType, nil
+}
+
+// rawFileName returns the file name of the Content-Disposition header of a raw upload, if any.
+func rawFileName(r *http.Request) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// extensionOf returns the lower case extension of the file name, a file without name has no extension.
+func extensionOf(fileName string) string {
+	return strings.ToLower(path.Ext(fileName))
+}
+
+// sizeLimitedReader fails with ErrFileTooLarge as soon as more than limit bytes are read.
+type sizeLimitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func newSizeLimitedReader(reader io.Reader, limit int64) io.Reader {
+	return &sizeLimitedReader{reader: reader, remaining: limit}
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrFileTooLarge
+	}
+	// one byte more than allowed is read to detect content that exceeds the limit
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.reader.Read(p)
+	if int64(n) > r.remaining {
+		// the bytes up to the limit are kept, so that a resumable upload stores them
+		allowed := int(r.remaining)
+		r.remaining = -1
+		return allowed, ErrFileTooLarge
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -2,33 +2,102 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
 	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/producer/file"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/health"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/storage"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/tracing"
 )
 
 func main() {
-	fmt.Println("Starting producer...")
+	cfg := file.DefaultConfig()
+	if err := config.Load("producer", os.Args[1:], &cfg); err != nil {
+		slog.Error("Error loading configuration", logging.Error(err))
+		os.Exit(2)
+	}
+	if err := logging.Setup("producer", cfg.Logging); err != nil {
+		slog.Error("Error setting up logging", logging.Error(err))
+		os.Exit(2)
+	}
+	if cfg.Mode != file.ModeSimulate {
+		// failures are only simulated by the load generator, an upload fails for real reasons only
+		file.DisableSimulatedFailures()
+	}
+
+	slog.Info("Starting producer", "mode", cfg.Mode)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, "producer", cfg.Tracing)
+	if err != nil {
+		slog.Error("Error setting up tracing", logging.Error(err))
+		return
+	}
+	defer shutdownTracing()
+
+	db, err := mongodb.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		slog.Error("Error connecting to MongoDB", logging.Error(err))
+		return
+	}
+	defer db.Disconnect()
+
+	store, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		slog.Error("Error creating storage", logging.Error(err))
+		return
+	}
+
 	var wg sync.WaitGroup
 
+	if cfg.Mode == file.ModeSimulate {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := file.SimulateStoreFile(ctx, db, store, cfg.Options())
+			if err != nil && !os.IsTimeout(err) && err != context.Canceled && err != context.DeadlineExceeded {
+				slog.Error("Error storing file", logging.Error(err))
+			}
+			cancel()
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := file.SimulateStoreFile(ctx)
-		if err != nil && !os.IsTimeout(err) && err != context.Canceled && err != context.DeadlineExceeded {
-			fmt.Printf("Error storing file: %v\n", err)
+		err := serveHTTP(ctx, cfg, db, store)
+		if err != nil {
+			slog.Error("Error serving http", logging.Error(err))
 		}
+		cancel()
 	}()
 
 	wg.Wait()
 
-	fmt.Println("Shutting down producer...")
+	slog.Info("Shutting down producer")
+}
+
+// serveHTTP serves the health endpoints and, unless the producer simulates files, the file API.
+func serveHTTP(ctx context.Context, cfg file.Config, db mongodb.Connection, store storage.BlobStore) error {
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.AddReadinessCheck("mongodb", db.HealthCheck)
+	checker.AddReadinessCheck("storage", store.HealthCheck)
+
+	mux := http.NewServeMux()
+	checker.Register(mux)
+	if cfg.Mode == file.ModeHTTP {
+		file.RegisterFileAPI(mux, db, store, cfg.Options())
+	}
+
+	return health.Serve(ctx, cfg.HTTPAddress, mux)
 }
@@ -0,0 +1,44 @@
+#!/bin/bash
+
+# Replays every event to the consumer a second time and verifies afterwards that the read model matches the stored files
+# and that the inbox skipped the duplicates instead of applying them again.
+# The miner publishes at least once, so the first run can already contain duplicates.
+# Requires a fresh system under test: ./drop-sut.sh && ./run-sut.sh
+#
+# Environment:
+#   DURATION  seconds the producer stores files (default 60)
+#   DRAIN     seconds the consumer runs after the producer stopped and again for the replay (default 30)
+
+DURATION=${DURATION:-60}
+DRAIN=${DRAIN:-30}
+GROUP_ID="duplicates-$(date +%s)"
+
+cd "$(dirname "$0")/../.."
+
+bin=$(mktemp -d)
+trap 'rm -rf "$bin"; kill $miner_pid $consumer_pid 2>/dev/null' EXIT
+
+(cd producer && go build -o "$bin/producer" .) || exit 1
+(cd miner && go build -o "$bin/miner" .) || exit 1
+(cd consumer && go build -o "$bin/consumer" . && go build -o "$bin/verifyprojection" ./cmd/verifyprojection) || exit 1
+
+(cd miner && exec "$bin/miner") &
+miner_pid=$!
+(cd consumer && exec "$bin/consumer" -group-id "$GROUP_ID") &
+consumer_pid=$!
+
+(cd producer && timeout "$DURATION" "$bin/producer" -mode simulate)
+
+echo "Producer stopped, consumer catches up for ${DRAIN}s..."
+sleep "$DRAIN"
+kill -INT $consumer_pid
+wait $consumer_pid
+
+echo "Replaying all events with a new consumer group for ${DRAIN}s..."
+(cd consumer && timeout "$DRAIN" "$bin/consumer" -group-id "$GROUP_ID-replay")
+
+kill -INT $miner_pid
+wait $miner_pid
+
+echo "Verifying read model..."
+"$bin/verifyprojection"
@@ -0,0 +1,60 @@
+#!/bin/bash
+
+# Kills the miner randomly at a crash point while the producer stores files and verifies afterwards
+# that every stored file was published exactly once.
+# Requires a fresh system under test: ./drop-sut.sh && ./run-sut.sh
+#
+# Environment:
+#   DURATION           seconds the producer stores files while the miner crashes (default 120)
+#   DRAIN              seconds the miner runs without crashes afterwards to catch up (default 30)
+#   TRANSACTIONAL      true publishes event and resume token in one transaction (default true)
+#   CRASH_POINT        before-commit or after-publish (default before-commit, after-publish for TRANSACTIONAL=false)
+#   CRASH_PROBABILITY  chance to crash each time the crash point is reached (default 0.2)
+
+DURATION=${DURATION:-120}
+DRAIN=${DRAIN:-30}
+TRANSACTIONAL=${TRANSACTIONAL:-true}
+if [ "$TRANSACTIONAL" = "true" ]; then
+    CRASH_POINT=${CRASH_POINT:-before-commit}
+else
+    CRASH_POINT=${CRASH_POINT:-after-publish}
+fi
+CRASH_PROBABILITY=${CRASH_PROBABILITY:-0.2}
+CRASH_EXIT_CODE=3
+TIMEOUT_EXIT_CODE=124
+
+cd "$(dirname "$0")/../.."
+
+bin=$(mktemp -d)
+trap 'rm -rf "$bin"' EXIT
+
+(cd producer && go build -o "$bin/producer" .) || exit 1
+(cd miner && go build -o "$bin/miner" . && go build -o "$bin/verifydelivery" ./cmd/verifydelivery) || exit 1
+
+(cd producer && exec "$bin/producer" -mode simulate) &
+producer_pid=$!
+
+crashes=0
+end=$(( $(date +%s) + DURATION ))
+while [ "$(date +%s)" -lt "$end" ]; do
+    (cd miner && MINER_CRASH_POINT=$CRASH_POINT MINER_CRASH_PROBABILITY=$CRASH_PROBABILITY \
+        timeout $(( end - $(date +%s) )) "$bin/miner" -transactional="$TRANSACTIONAL")
+    exit_code=$?
+    if [ $exit_code -eq $CRASH_EXIT_CODE ]; then
+        crashes=$(( crashes + 1 ))
+        echo "Miner crashed at $CRASH_POINT ($crashes), restarting..."
+    elif [ $exit_code -ne $TIMEOUT_EXIT_CODE ] && [ $exit_code -ne 0 ]; then
+        echo "Miner failed with exit code $exit_code"
+        kill -INT $producer_pid
+        exit 1
+    fi
+done
+
+kill -INT $producer_pid
+wait $producer_pid
+
+echo "Producer stopped, miner catches up for ${DRAIN}s..."
+(cd miner && timeout "$DRAIN" "$bin/miner" -transactional="$TRANSACTIONAL")
+
+echo "Miner crashed $crashes times, verifying delivery..."
+"$bin/verifydelivery"
@@ -0,0 +1,238 @@
+// Package config loads the configuration of a service from defaults, a YAML file, environment variables and flags.
+// Later sources take precedence: defaults < YAML file < environment variables < flags.
+//
+// The configuration is a struct, the service fills it with its defaults before loading. Fields are bound by tags:
+//
+//	URI string `yaml:"uri" env:"MONGODB_URI" flag:"mongodb-uri" usage:"connection string of MongoDB"`
+//
+// Nested structs are traversed. The YAML file is passed by the flag -config or the environment variable CONFIG_FILE.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFileFlag = "config"
+	ConfigFileEnv  = "CONFIG_FILE"
+)
+
+// Validator is implemented by configurations that check their values after loading.
+type Validator interface {
+	Validate() error
+}
+
+type field struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+type flagValue struct {
+	field *field
+	raw   string
+}
+
+// Load overwrites the defaults in cfg, which must be a pointer to a struct, and validates the result.
+// args are the command line arguments without the program name.
+func Load(name string, args []string, cfg any) error {
+	return LoadWithFlags(flag.NewFlagSet(name, flag.ExitOnError), args, cfg)
+}
+
+// LoadWithFlags is Load for a command that has flags of its own, e.g. a subcommand of a CLI. The command registers its flags on
+// flags before, they are parsed together with the flags of the configuration.
+func LoadWithFlags(flags *flag.FlagSet, args []string, cfg any) error {
+	root := reflect.ValueOf(cfg)
+	if root.Kind() != reflect.Pointer || root.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configuration must be a pointer to a struct, got %T", cfg)
+	}
+
+	fields := collectFields(root.Elem())
+
+	configFile := flags.String(ConfigFileFlag, os.Getenv(ConfigFileEnv), fmt.Sprintf("YAML configuration file (env %s)", ConfigFileEnv))
+	var flagValues []flagValue
+	for _, f := range fields {
+		if f.flag == "" {
+			continue
+		}
+
+		usage := fmt.Sprintf("%s (default %s", f.usage, formatValue(f.value))
+		if f.env != "" {
+			usage += fmt.Sprintf(", env %s", f.env)
+		}
+		usage += ")"
+
+		collect := func(raw string) error {
+			flagValues = append(flagValues, flagValue{field: f, raw: raw})
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			flags.BoolFunc(f.flag, usage, collect)
+		} else {
+			flags.Func(f.flag, usage, collect)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, cfg); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(f.env); ok {
+			if err := setValue(f.value, raw); err != nil {
+				return fmt.Errorf("invalid value of environment variable %s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, v := range flagValues {
+		if err := setValue(v.field.value, v.raw); err != nil {
+			return fmt.Errorf("invalid value of flag -%s: %w", v.field.flag, err)
+		}
+	}
+
+	if validator, ok := cfg.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func loadFile(path string, cfg any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// a misspelled key would silently keep the default
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func collectFields(value reflect.Value) []*field {
+	var fields []*field
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		fieldValue := value.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		if fieldValue.Kind() == reflect.Struct && fieldValue.Type() != durationType {
+			fields = append(fields, collectFields(fieldValue)...)
+			continue
+		}
+
+		env, flagName := structField.Tag.Get("env"), structField.Tag.Get("flag")
+		if env == "" && flagName == "" {
+			continue
+		}
+		fields = append(fields, &field{
+			value: fieldValue,
+			env:   env,
+			flag:  flagName,
+			usage: structField.Tag.Get("usage"),
+		})
+	}
+
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func formatValue(value reflect.Value) string {
+	if value.Kind() == reflect.Slice {
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = formatValue(value.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		// comma separated, e.g. 'kafka-1:9092,kafka-2:9092' or '1m,10m'
+		items := reflect.Zero(value.Type())
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			element := reflect.New(value.Type().Elem()).Elem()
+			if err := setValue(element, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, element)
+		}
+		value.Set(items)
+	default:
+		return fmt.Errorf("type %s is not supported", value.Type())
+	}
+
+	return nil
+}
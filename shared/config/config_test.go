@@ -0,0 +1,241 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name    string          `yaml:"name" env:"TEST_NAME" flag:"name" usage:"name"`
+	Delays  []time.Duration `yaml:"delays" env:"TEST_DELAYS" flag:"delays" usage:"delays"`
+	Brokers []string        `yaml:"brokers" env:"TEST_BROKERS" flag:"brokers" usage:"brokers"`
+	Enabled bool            `yaml:"enabled" env:"TEST_ENABLED" flag:"enabled" usage:"enabled"`
+	Server  testServer      `yaml:"server"`
+}
+
+type testServer struct {
+	Port    int           `yaml:"port" env:"TEST_PORT" flag:"port" usage:"port"`
+	Timeout time.Duration `yaml:"timeout" env:"TEST_TIMEOUT" flag:"timeout" usage:"timeout"`
+}
+
+var (
+	errNameRequired = errors.New("name is required")
+	errInvalidPort  = errors.New("port must be positive")
+)
+
+func (c *testConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errNameRequired)
+	}
+	if c.Server.Port <= 0 {
+		errs = append(errs, errInvalidPort)
+	}
+	return errors.Join(errs...)
+}
+
+func defaultTestConfig() testConfig {
+	return testConfig{
+		Name:   "default",
+		Delays: []time.Duration{time.Minute},
+		Server: testServer{Port: 8080, Timeout: time.Second},
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write configuration file: %v", err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) testConfig {
+	t.Helper()
+
+	cfg := defaultTestConfig()
+	if err := Load("test", args, &cfg); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return cfg
+}
+
+// defaults < YAML file < environment variables < flags
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "name: yaml\nserver:\n  port: 1\n  timeout: 5s\nenabled: true\n")
+	t.Setenv(ConfigFileEnv, path)
+	t.Setenv("TEST_PORT", "2")
+	t.Setenv("TEST_NAME", "env")
+
+	cfg := load(t, "-name", "flag")
+
+	if cfg.Name != "flag" {
+		t.Errorf("name is %q, want the flag over the environment variable", cfg.Name)
+	}
+	if cfg.Server.Port != 2 {
+		t.Errorf("port is %d, want the environment variable over the file", cfg.Server.Port)
+	}
+	if cfg.Server.Timeout != 5*time.Second || !cfg.Enabled {
+		t.Errorf("timeout is %v and enabled %v, want the values of the file", cfg.Server.Timeout, cfg.Enabled)
+	}
+	if !slices.Equal(cfg.Delays, []time.Duration{time.Minute}) {
+		t.Errorf("delays are %v, want the default", cfg.Delays)
+	}
+}
+
+func TestLoadConfigFileFlag(t *testing.T) {
+	path := writeConfigFile(t, "name: yaml\n")
+
+	if cfg := load(t, "-config", path); cfg.Name != "yaml" {
+		t.Fatalf("name is %q, want the value of the file passed by -config", cfg.Name)
+	}
+}
+
+func TestLoadParsesSlicesAndDurations(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		args        []string
+		file        string
+		wantDelays  []time.Duration
+		wantBrokers []string
+		wantTimeout time.Duration
+	}{
+		{
+			name:        "environment variables",
+			env:         map[string]string{"TEST_DELAYS": "1m, 10m", "TEST_BROKERS": "kafka-1:9092,kafka-2:9092", "TEST_TIMEOUT": "1m30s"},
+			wantDelays:  []time.Duration{time.Minute, 10 * time.Minute},
+			wantBrokers: []string{"kafka-1:9092", "kafka-2:9092"},
+			wantTimeout: 90 * time.Second,
+		},
+		{
+			name:        "flags",
+			args:        []string{"-delays", "30s,1h", "-brokers", "kafka:9092", "-timeout", "250ms"},
+			wantDelays:  []time.Duration{30 * time.Second, time.Hour},
+			wantBrokers: []string{"kafka:9092"},
+			wantTimeout: 250 * time.Millisecond,
+		},
+		{
+			name:        "file",
+			file:        "delays: [2m, 20m]\nbrokers: [kafka:9092]\nserver:\n  timeout: 3s\n",
+			wantDelays:  []time.Duration{2 * time.Minute, 20 * time.Minute},
+			wantBrokers: []string{"kafka:9092"},
+			wantTimeout: 3 * time.Second,
+		},
+		{
+			name:        "empty list",
+			env:         map[string]string{"TEST_DELAYS": ""},
+			wantDelays:  nil,
+			wantTimeout: time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, test.file)}, args...)
+			}
+
+			cfg := load(t, args...)
+
+			if !slices.Equal(cfg.Delays, test.wantDelays) {
+				t.Errorf("delays are %v, want %v", cfg.Delays, test.wantDelays)
+			}
+			if !slices.Equal(cfg.Brokers, test.wantBrokers) {
+				t.Errorf("brokers are %v, want %v", cfg.Brokers, test.wantBrokers)
+			}
+			if cfg.Server.Timeout != test.wantTimeout {
+				t.Errorf("timeout is %v, want %v", cfg.Server.Timeout, test.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "duration of environment variable", env: map[string]string{"TEST_TIMEOUT": "soon"}, want: "TEST_TIMEOUT"},
+		{name: "duration in list of environment variable", env: map[string]string{"TEST_DELAYS": "1m,later"}, want: "TEST_DELAYS"},
+		{name: "integer of flag", args: []string{"-port", "http"}, want: "-port"},
+		{name: "boolean of environment variable", env: map[string]string{"TEST_ENABLED": "sometimes"}, want: "TEST_ENABLED"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			cfg := defaultTestConfig()
+
+			err := Load("test", test.args, &cfg)
+
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("Load returned %v, want an error naming %s", err, test.want)
+			}
+		})
+	}
+}
+
+// A misspelled key would silently keep the default.
+func TestLoadRejectsUnknownKeyOfFile(t *testing.T) {
+	path := writeConfigFile(t, "name: yaml\nserver:\n  prot: 1\n")
+	cfg := defaultTestConfig()
+
+	err := Load("test", []string{"-config", path}, &cfg)
+
+	if err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("Load returned %v, want an error naming the unknown key", err)
+	}
+}
+
+func TestLoadReturnsAllValidationErrors(t *testing.T) {
+	cfg := defaultTestConfig()
+
+	err := Load("test", []string{"-name", "", "-port", "0"}, &cfg)
+
+	if !errors.Is(err, errNameRequired) || !errors.Is(err, errInvalidPort) {
+		t.Fatalf("Load returned %v, want both validation errors", err)
+	}
+}
+
+func TestLoadRequiresPointerToStruct(t *testing.T) {
+	if err := Load("test", nil, defaultTestConfig()); err == nil {
+		t.Fatal("Load of a struct value succeeded, want an error")
+	}
+}
+
+// The flags of a subcommand can be mixed with the configuration flags in any order.
+func TestLoadWithFlagsParsesCommandFlags(t *testing.T) {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	entry := flags.String("entry", "", "entry")
+	all := flags.Bool("all", false, "all")
+	cfg := defaultTestConfig()
+
+	err := LoadWithFlags(flags, []string{"-entry", "0/42", "-name", "flag", "-all"}, &cfg)
+
+	if err != nil {
+		t.Fatalf("LoadWithFlags failed: %v", err)
+	}
+	if *entry != "0/42" || !*all {
+		t.Fatalf("command flags are entry %q and all %v, want 0/42 and true", *entry, *all)
+	}
+	if cfg.Name != "flag" {
+		t.Fatalf("name is %q, want the value of the flag", cfg.Name)
+	}
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// MongoDB is the connection shared by all services. Settings that are zero keep the value of the URI or the default of the driver.
+type MongoDB struct {
+	URI                    string        `yaml:"uri" env:"MONGODB_URI" flag:"mongodb-uri" usage:"connection string of the MongoDB replica set"`
+	ConnectTimeout         time.Duration `yaml:"connectTimeout" env:"MONGODB_CONNECT_TIMEOUT" flag:"mongodb-connect-timeout" usage:"timeout of establishing a connection"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout" env:"MONGODB_SERVER_SELECTION_TIMEOUT" flag:"mongodb-server-selection-timeout" usage:"timeout of finding a server for an operation"`
+	SocketTimeout          time.Duration `yaml:"socketTimeout" env:"MONGODB_SOCKET_TIMEOUT" flag:"mongodb-socket-timeout" usage:"timeout of a read or write on a connection, 0 waits forever"`
+	DisconnectTimeout      time.Duration `yaml:"disconnectTimeout" env:"MONGODB_DISCONNECT_TIMEOUT" flag:"mongodb-disconnect-timeout" usage:"timeout of closing the connections on shutdown"`
+	TLS                    bool          `yaml:"tls" env:"MONGODB_TLS" flag:"mongodb-tls" usage:"connect with TLS"`
+	TLSCAFile              string        `yaml:"tlsCAFile" env:"MONGODB_TLS_CA_FILE" flag:"mongodb-tls-ca-file" usage:"PEM file of the certificate authorities of the server"`
+	TLSCertificateKeyFile  string        `yaml:"tlsCertificateKeyFile" env:"MONGODB_TLS_CERTIFICATE_KEY_FILE" flag:"mongodb-tls-certificate-key-file" usage:"PEM file with the client certificate and its private key"`
+	TLSInsecure            bool          `yaml:"tlsInsecure" env:"MONGODB_TLS_INSECURE" flag:"mongodb-tls-insecure" usage:"skip the verification of the server certificate, only for development"`
+	Username               string        `yaml:"username" env:"MONGODB_USERNAME" flag:"mongodb-username" usage:"user of the authentication"`
+	Password               string        `yaml:"password" env:"MONGODB_PASSWORD" flag:"mongodb-password" usage:"password of the authentication, prefer the environment variable"`
+	AuthSource             string        `yaml:"authSource" env:"MONGODB_AUTH_SOURCE" flag:"mongodb-auth-source" usage:"database of the user"`
+	AuthMechanism          string        `yaml:"authMechanism" env:"MONGODB_AUTH_MECHANISM" flag:"mongodb-auth-mechanism" usage:"authentication mechanism, e.g. SCRAM-SHA-256 or MONGODB-X509"`
+	ReadConcern            string        `yaml:"readConcern" env:"MONGODB_READ_CONCERN" flag:"mongodb-read-concern" usage:"read concern level: local, available, majority, linearizable or snapshot"`
+	WriteConcern           string        `yaml:"writeConcern" env:"MONGODB_WRITE_CONCERN" flag:"mongodb-write-concern" usage:"write concern: majority or the number of acknowledging members"`
+	MinPoolSize            uint64        `yaml:"minPoolSize" env:"MONGODB_MIN_POOL_SIZE" flag:"mongodb-min-pool-size" usage:"minimum number of connections per server"`
+	MaxPoolSize            uint64        `yaml:"maxPoolSize" env:"MONGODB_MAX_POOL_SIZE" flag:"mongodb-max-pool-size" usage:"maximum number of connections per server"`
+	ConnectRetries         int           `yaml:"connectRetries" env:"MONGODB_CONNECT_RETRIES" flag:"mongodb-connect-retries" usage:"retries of a failed connect at startup"`
+	ConnectRetryInterval   time.Duration `yaml:"connectRetryInterval" env:"MONGODB_CONNECT_RETRY_INTERVAL" flag:"mongodb-connect-retry-interval" usage:"wait between two connect attempts"`
+}
+
+func DefaultMongoDB() MongoDB {
+	return MongoDB{
+		URI:                    "mongodb://localhost:27017/?replicaSet=rs0",
+		ConnectTimeout:         10 * time.Second,
+		ServerSelectionTimeout: 10 * time.Second,
+		DisconnectTimeout:      5 * time.Second,
+		ConnectRetries:         5,
+		ConnectRetryInterval:   2 * time.Second,
+	}
+}
+
+func (c MongoDB) Validate() error {
+	var errs []error
+	if c.URI == "" {
+		errs = append(errs, errors.New("mongodb uri is required"))
+	}
+	if !c.TLS && (c.TLSCAFile != "" || c.TLSCertificateKeyFile != "" || c.TLSInsecure) {
+		errs = append(errs, errors.New("mongodb tls files and tls insecure require tls"))
+	}
+	if c.Password != "" && c.Username == "" {
+		errs = append(errs, errors.New("mongodb password requires a username"))
+	}
+	switch c.ReadConcern {
+	case "", "local", "available", "majority", "linearizable", "snapshot":
+	default:
+		errs = append(errs, fmt.Errorf("mongodb read concern %q is not supported", c.ReadConcern))
+	}
+	if c.WriteConcern != "" && c.WriteConcern != "majority" {
+		if w, err := strconv.Atoi(c.WriteConcern); err != nil || w < 0 {
+			errs = append(errs, fmt.Errorf("mongodb write concern %q must be majority or a number", c.WriteConcern))
+		}
+	}
+	if c.MaxPoolSize != 0 && c.MinPoolSize > c.MaxPoolSize {
+		errs = append(errs, errors.New("mongodb min pool size must not exceed the max pool size"))
+	}
+	if err := Positive("mongodb disconnect timeout", c.DisconnectTimeout); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ConnectRetries < 0 {
+		errs = append(errs, errors.New("mongodb connect retries must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Kafka is the connection and the topic of the file events.
+type Kafka struct {
+	Brokers []string `yaml:"brokers" env:"KAFKA_BROKERS" flag:"kafka-brokers" usage:"comma separated Kafka brokers"`
+	Topic   string   `yaml:"topic" env:"KAFKA_TOPIC" flag:"kafka-topic" usage:"topic of the file events"`
+}
+
+func DefaultKafka() Kafka {
+	return Kafka{
+		Brokers: []string{"localhost:9095"},
+		Topic:   "file-stored",
+	}
+}
+
+func (c Kafka) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("at least one kafka broker is required")
+	}
+	if c.Topic == "" {
+		return errors.New("kafka topic is required")
+	}
+
+	return nil
+}
+
+// Storage is the location of the file bytes shared by producer and cleaner.
+type Storage struct {
+	Backend string    `yaml:"backend" env:"STORAGE_BACKEND" flag:"storage-backend" usage:"where the file bytes are stored: local or s3"`
+	Path    string    `yaml:"path" env:"STORAGE_PATH" flag:"storage-path" usage:"directory of the file bytes for backend local"`
+	S3      S3Storage `yaml:"s3"`
+}
+
+// S3Storage is a bucket of an S3-compatible object storage, e.g. MinIO.
+type S3Storage struct {
+	Endpoint  string `yaml:"endpoint" env:"STORAGE_S3_ENDPOINT" flag:"storage-s3-endpoint" usage:"host and port of the object storage"`
+	Bucket    string `yaml:"bucket" env:"STORAGE_S3_BUCKET" flag:"storage-s3-bucket" usage:"bucket of the file bytes, it is created if it does not exist"`
+	Region    string `yaml:"region" env:"STORAGE_S3_REGION" flag:"storage-s3-region" usage:"region of the bucket"`
+	AccessKey string `yaml:"accessKey" env:"STORAGE_S3_ACCESS_KEY" flag:"storage-s3-access-key" usage:"access key of the object storage"`
+	SecretKey string `yaml:"secretKey" env:"STORAGE_S3_SECRET_KEY" flag:"storage-s3-secret-key" usage:"secret key of the object storage"`
+	TLS       bool   `yaml:"tls" env:"STORAGE_S3_TLS" flag:"storage-s3-tls" usage:"connect to the object storage with TLS"`
+	// PartSizeMiB bounds the memory of an upload, the size of a blob is unknown while it is written, so each part is buffered
+	PartSizeMiB uint64 `yaml:"partSizeMiB" env:"STORAGE_S3_PART_SIZE_MIB" flag:"storage-s3-part-size-mib" usage:"size of a part of a multipart upload in MiB"`
+}
+
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+	// S3 limits the size of a part and the number of parts, the largest blob is 10000 parts
+	minS3PartSizeMiB = 5
+	maxS3PartSizeMiB = 5 * 1024
+)
+
+func DefaultStorage(path string) Storage {
+	return Storage{
+		Backend: StorageBackendLocal,
+		Path:    path,
+		S3: S3Storage{
+			Endpoint:    "localhost:9000",
+			Bucket:      "files",
+			PartSizeMiB: 16,
+		},
+	}
+}
+
+func (c Storage) Validate() error {
+	switch c.Backend {
+	case StorageBackendLocal:
+		if c.Path == "" {
+			return errors.New("storage path is required for backend local")
+		}
+	case StorageBackendS3:
+		if c.S3.Endpoint == "" || c.S3.Bucket == "" {
+			return errors.New("storage s3 endpoint and bucket are required for backend s3")
+		}
+		if c.S3.PartSizeMiB < minS3PartSizeMiB || c.S3.PartSizeMiB > maxS3PartSizeMiB {
+			return fmt.Errorf("storage s3 part size must be between %d and %d MiB", minS3PartSizeMiB, maxS3PartSizeMiB)
+		}
+	default:
+		return fmt.Errorf("storage backend %q is not supported, use %s or %s", c.Backend, StorageBackendLocal, StorageBackendS3)
+	}
+
+	return nil
+}
+
+// Health configures the checks of /healthz and /readyz.
+type Health struct {
+	CheckTimeout time.Duration `yaml:"checkTimeout" env:"HEALTH_CHECK_TIMEOUT" flag:"health-check-timeout" usage:"timeout of a single health check"`
+}
+
+func DefaultHealth() Health {
+	return Health{
+		CheckTimeout: 2 * time.Second,
+	}
+}
+
+func (c Health) Validate() error {
+	return Positive("health check timeout", c.CheckTimeout)
+}
+
+// Logging configures the structured logs of the services.
+type Logging struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"minimum level of the logs: debug, info, warn or error"`
+	Format string `yaml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"format of the logs: json or text"`
+}
+
+func DefaultLogging() Logging {
+	return Logging{
+		Level:  "info",
+		Format: "json",
+	}
+}
+
+func (c Logging) Validate() error {
+	var errs []error
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log level %q is not supported", c.Level))
+	}
+	if c.Format != "json" && c.Format != "text" {
+		errs = append(errs, fmt.Errorf("log format %q is not supported", c.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Tracing configures the export of the OpenTelemetry traces.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" usage:"exporter of the traces: none, otlp or stdout"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint" usage:"URL of the OTLP/HTTP traces endpoint of the collector"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" usage:"share of the traces started by this service that are sampled, 1 samples all"`
+}
+
+func DefaultTracing() Tracing {
+	return Tracing{
+		Exporter:    "none",
+		Endpoint:    "http://localhost:4318/v1/traces",
+		SampleRatio: 1,
+	}
+}
+
+func (c Tracing) Validate() error {
+	var errs []error
+	switch c.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Endpoint == "" {
+			errs = append(errs, errors.New("tracing endpoint is required for exporter otlp"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing exporter %q is not supported", c.Exporter))
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing sample ratio must be between 0 and 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Positive returns an error if a numeric setting is not greater than zero.
+func Positive[T ~int | ~int64 | ~float64](name string, value T) error {
+	if value <= 0 {
+		return fmt.Errorf("%s must be greater than zero, got %v", name, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package health serves the liveness and readiness endpoints of the services.
+//
+// GET /healthz fails if a liveness check fails, Kubernetes restarts the container then.
+// GET /readyz fails if a liveness or a readiness check fails, Kubernetes stops routing traffic to the container then.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check returns an error if the checked dependency or component is not healthy.
+type Check func(ctx context.Context) error
+
+// Checker runs the registered checks for each request, every check gets its own timeout.
+type Checker struct {
+	timeout   time.Duration
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout:   timeout,
+		liveness:  map[string]Check{},
+		readiness: map[string]Check{},
+	}
+}
+
+// AddLivenessCheck registers a check that only fails if a restart helps, e.g. a stalled loop.
+func (c *Checker) AddLivenessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check of a dependency, e.g. the database. A restart does not fix an unavailable dependency.
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness[name] = check
+}
+
+// Register adds GET /healthz and GET /readyz to the mux.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", c.HealthzHandler)
+	mux.HandleFunc("GET /readyz", c.ReadyzHandler)
+}
+
+func (c *Checker) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	checks := copyChecks(c.liveness)
+	c.mu.RUnlock()
+
+	writeReport(w, c.run(r.Context(), checks))
+}
+
+func (c *Checker) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	checks := copyChecks(c.liveness, c.readiness)
+	c.mu.RUnlock()
+
+	writeReport(w, c.run(r.Context(), checks))
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	statusOk          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// run executes the checks in parallel, a check that exceeds the timeout fails.
+func (c *Checker) run(ctx context.Context, checks map[string]Check) report {
+	result := report{Status: statusOk, Checks: make(map[string]string, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.runCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Status = statusUnavailable
+				result.Checks[name] = err.Error()
+				return
+			}
+			result.Checks[name] = statusOk
+		}()
+	}
+	wg.Wait()
+
+	return result
+}
+
+func (c *Checker) runCheck(ctx context.Context, check Check) error {
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check(checkCtx)
+	}()
+
+	// checks that ignore the context must not block the probe
+	select {
+	case err := <-done:
+		return err
+	case <-checkCtx.Done():
+		return fmt.Errorf("check did not finish within %s", c.timeout)
+	}
+}
+
+func writeReport(w http.ResponseWriter, result report) {
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status != statusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func copyChecks(sources ...map[string]Check) map[string]Check {
+	checks := map[string]Check{}
+	for _, source := range sources {
+		for name, check := range source {
+			checks[name] = check
+		}
+	}
+
+	return checks
+}
+
+// Serve runs an HTTP server on address until ctx is cancelled.
+func Serve(ctx context.Context, address string, handler http.Handler) error {
+	server := &http.Server{Addr: address, Handler: handler}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("HTTP server listening", "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// KafkaCheck connects to the brokers and fetches the metadata of the cluster.
+func KafkaCheck(brokers []string) Check {
+	return func(ctx context.Context) error {
+		config := sarama.NewConfig()
+		config.Metadata.Retry.Max = 0
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout := time.Until(deadline)
+			config.Net.DialTimeout = timeout
+			config.Net.ReadTimeout = timeout
+			config.Net.WriteTimeout = timeout
+		}
+
+		client, err := sarama.NewClient(brokers, config)
+		if err != nil {
+			return fmt.Errorf("failed to connect to Kafka: %w", err)
+		}
+		defer client.Close()
+
+		if len(client.Brokers()) == 0 {
+			return fmt.Errorf("no Kafka broker available")
+		}
+
+		return nil
+	}
+}
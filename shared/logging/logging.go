@@ -0,0 +1,80 @@
+// Package logging configures log/slog for the services.
+//
+// All services log JSON to stdout with the same keys, so that the log aggregation can correlate a file across services.
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// Keys of the log attributes shared by all services
+const (
+	KeyService       = "service"
+	KeyFileId        = "file_id"
+	KeyTopic         = "topic"
+	KeyPartition     = "partition"
+	KeyOffset        = "offset"
+	KeyResumeToken   = "resume_token"
+	KeyCorrelationId = "correlation_id"
+	KeyEventType     = "event_type"
+	KeyError         = "error"
+	KeyDocument      = "document"
+)
+
+var level = new(slog.LevelVar)
+
+// Setup replaces the default logger of slog, every record carries the name of the service.
+func Setup(service string, cfg config.Logging) error {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("log level %q is not supported: %w", cfg.Level, err)
+	}
+	level.Set(minLevel)
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, options)
+	default:
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+
+	slog.SetDefault(slog.New(handler).With(KeyService, service))
+	return nil
+}
+
+// Error is the attribute of an error.
+func Error(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// ResumeToken identifies a resume token by its hex encoded SHA-256, the same value as the resume-token-hash header of the miner.
+func ResumeToken(token []byte) slog.Attr {
+	hash := sha256.Sum256(token)
+	return slog.String(KeyResumeToken, hex.EncodeToString(hash[:]))
+}
+
+// Document is the attribute of a document or an event that may contain user data.
+// Its content is only logged if the level is debug, otherwise it is redacted.
+func Document(document any) slog.Attr {
+	return slog.Any(KeyDocument, redacted{document: document})
+}
+
+type redacted struct {
+	document any
+}
+
+func (r redacted) LogValue() slog.Value {
+	if level.Level() > slog.LevelDebug {
+		return slog.StringValue("[redacted]")
+	}
+
+	return slog.StringValue(fmt.Sprintf("%+v", r.document))
+}
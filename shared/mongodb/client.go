@@ -0,0 +1,202 @@
+// Package mongodb creates the MongoDB client of the services and owns its lifecycle.
+//
+// The services receive the Connection from main instead of creating their own client, so that the packages of a service share one connection pool
+// and main decides when it is closed. A service that is tested without MongoDB declares the collection operations it uses as an interface,
+// which *mongo.Collection implements, e.g. clean.FileMetadata of the cleaner. Tests against MongoDB use the package mongodbtest.
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+// Connection is what the services need from MongoDB.
+type Connection interface {
+	Database(name string) *mongo.Database
+	// HealthCheck returns an error if the primary of the replica set is not reachable.
+	HealthCheck(ctx context.Context) error
+}
+
+// Client is the Connection to a MongoDB replica set.
+type Client struct {
+	client            *mongo.Client
+	disconnectTimeout time.Duration
+}
+
+var _ Connection = (*Client)(nil)
+
+// Connect creates the client and pings the primary. A failed ping is retried, so that a service can start before MongoDB is ready.
+func Connect(ctx context.Context, cfg config.MongoDB) (*Client, error) {
+	clientOptions, err := NewClientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		client, err := connect(ctx, clientOptions)
+		if err == nil {
+			return &Client{client: client, disconnectTimeout: cfg.DisconnectTimeout}, nil
+		}
+		if attempt >= cfg.ConnectRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		slog.Warn("Connecting to MongoDB failed, retrying", "retry_in", cfg.ConnectRetryInterval, logging.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(cfg.ConnectRetryInterval):
+		}
+	}
+}
+
+func connect(ctx context.Context, clientOptions *options.ClientOptions) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	slog.Info("MongoDB client initialized")
+
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+	slog.Info("MongoDB ping successful")
+
+	return client, nil
+}
+
+// NewClientOptions applies the configuration on top of the URI.
+func NewClientOptions(cfg config.MongoDB) (*options.ClientOptions, error) {
+	clientOptions := options.Client().ApplyURI(cfg.URI)
+
+	if cfg.ConnectTimeout > 0 {
+		clientOptions.SetConnectTimeout(cfg.ConnectTimeout)
+	}
+	if cfg.ServerSelectionTimeout > 0 {
+		clientOptions.SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	}
+	if cfg.SocketTimeout > 0 {
+		clientOptions.SetSocketTimeout(cfg.SocketTimeout)
+	}
+	if cfg.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(cfg.MinPoolSize)
+	}
+	if cfg.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+
+	if cfg.TLS {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	// credentials of the URI are kept unless they are configured explicitly
+	if cfg.Username != "" || cfg.AuthMechanism != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username:      cfg.Username,
+			Password:      cfg.Password,
+			PasswordSet:   cfg.Password != "",
+			AuthSource:    cfg.AuthSource,
+			AuthMechanism: cfg.AuthMechanism,
+		})
+	}
+
+	if cfg.ReadConcern != "" {
+		clientOptions.SetReadConcern(&readconcern.ReadConcern{Level: cfg.ReadConcern})
+	}
+	if cfg.WriteConcern != "" {
+		writeConcern, err := parseWriteConcern(cfg.WriteConcern)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetWriteConcern(writeConcern)
+	}
+
+	return clientOptions, nil
+}
+
+func newTLSConfig(cfg config.MongoDB) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+
+	if cfg.TLSCAFile != "" {
+		caFile, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca file: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caFile) {
+			return nil, fmt.Errorf("tls ca file %s contains no certificate", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if cfg.TLSCertificateKeyFile != "" {
+		// the certificate and the private key are in the same file like in the tlsCertificateKeyFile option of the URI
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSCertificateKeyFile, cfg.TLSCertificateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls certificate key file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func parseWriteConcern(value string) (*writeconcern.WriteConcern, error) {
+	if value == "majority" {
+		return writeconcern.Majority(), nil
+	}
+
+	w, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("write concern %q must be majority or a number: %w", value, err)
+	}
+
+	return &writeconcern.WriteConcern{W: w}, nil
+}
+
+func (c *Client) Database(name string) *mongo.Database {
+	return c.client.Database(name)
+}
+
+func (c *Client) HealthCheck(ctx context.Context) error {
+	if err := c.client.Ping(ctx, readpref.Primary()); err != nil {
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Disconnect closes the connections. It uses its own timeout because the application context is usually cancelled at this point.
+func (c *Client) Disconnect() {
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), c.disconnectTimeout)
+	defer cancel()
+
+	if err := c.client.Disconnect(disconnectCtx); err != nil {
+		slog.Error("Failed to disconnect MongoDB client", logging.Error(err))
+	} else {
+		slog.Info("MongoDB client disconnected")
+	}
+}
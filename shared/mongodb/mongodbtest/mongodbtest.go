@@ -0,0 +1,89 @@
+// Package mongodbtest connects tests to the MongoDB replica set of the development environment.
+// A test is skipped when MongoDB is not reachable, so that go test passes without the environment.
+package mongodbtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/mongodb"
+)
+
+// URIVariable overrides the connection string of config.DefaultMongoDB
+const URIVariable = "MONGODB_TEST_URI"
+
+var (
+	// unavailable skips the remaining tests of the package without waiting for the server selection timeout again
+	unavailable      error
+	unavailableMutex sync.Mutex
+)
+
+// connection prefixes the database names with a name unique to the test, so that tests do not see the data of each other.
+type connection struct {
+	*mongodb.Client
+	prefix    string
+	mutex     sync.Mutex
+	databases map[string]bool
+}
+
+// Connect returns a connection whose databases are dropped after the test. The test is skipped if MongoDB is not reachable.
+func Connect(t *testing.T) mongodb.Connection {
+	t.Helper()
+
+	unavailableMutex.Lock()
+	defer unavailableMutex.Unlock()
+	if unavailable != nil {
+		t.Skipf("MongoDB is not available, start it or set %s: %v", URIVariable, unavailable)
+	}
+
+	cfg := config.DefaultMongoDB()
+	if uri := os.Getenv(URIVariable); uri != "" {
+		cfg.URI = uri
+	}
+	cfg.ConnectTimeout = 2 * time.Second
+	cfg.ServerSelectionTimeout = 2 * time.Second
+	cfg.ConnectRetries = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mongodb.Connect(ctx, cfg)
+	if err != nil {
+		unavailable = err
+		t.Skipf("MongoDB is not available, start it or set %s: %v", URIVariable, err)
+	}
+
+	c := &connection{
+		Client:    client,
+		prefix:    fmt.Sprintf("test_%08x_", rand.Uint32()),
+		databases: map[string]bool{},
+	}
+	t.Cleanup(c.dropDatabases)
+
+	return c
+}
+
+func (c *connection) Database(name string) *mongo.Database {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.databases[name] = true
+
+	return c.Client.Database(c.prefix + name)
+}
+
+func (c *connection) dropDatabases() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for name := range c.databases {
+		c.Client.Database(c.prefix + name).Drop(ctx)
+	}
+	c.Client.Disconnect()
+}
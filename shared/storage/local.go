@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore stores the blobs as files below a directory, the slashes of a name are directories.
+type LocalStore struct {
+	root string
+}
+
+var _ BlobStore = (*LocalStore)(nil)
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Create(ctx context.Context, name string) (BlobWriter, error) {
+	location, err := s.location(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(location), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create folder of blob %s: %w", name, err)
+	}
+	// the blob is written to a temporary file, so that a reader never sees a partial blob
+	file, err := os.CreateTemp(filepath.Dir(location), "."+filepath.Base(location)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob %s: %w", name, err)
+	}
+
+	return &localWriter{file: file, location: location}, nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, name string) (BlobReader, error) {
+	location, err := s.location(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(location)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", name, err)
+	}
+
+	return file, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	location, err := s.location(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(location); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", name, err)
+	}
+
+	// folders only exist for their blobs, removing a folder that is not empty fails
+	for folder := filepath.Dir(location); folder != filepath.Clean(s.root); folder = filepath.Dir(folder) {
+		if os.Remove(folder) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, name string) (BlobInfo, error) {
+	location, err := s.location(name)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	info, err := os.Stat(location)
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobInfo{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return BlobInfo{}, fmt.Errorf("failed to stat blob %s: %w", name, err)
+	}
+
+	return BlobInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List walks the folder of the prefix, temporary files of blobs that are being written are listed too, so that they can be deleted.
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	folder := s.root
+	if index := strings.LastIndex(prefix, "/"); index >= 0 {
+		location, err := s.location(prefix[:index])
+		if err != nil {
+			return nil, err
+		}
+		folder = location
+	}
+
+	var blobs []BlobInfo
+	err := filepath.WalkDir(folder, func(location string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		relative, err := filepath.Rel(s.root, location)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, BlobInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs %s: %w", prefix, err)
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Name < blobs[j].Name })
+	return blobs, nil
+}
+
+func (s *LocalStore) HealthCheck(ctx context.Context) error {
+	if err := os.MkdirAll(s.root, os.ModePerm); err != nil {
+		return fmt.Errorf("storage directory is not accessible: %w", err)
+	}
+
+	return nil
+}
+
+// location returns the file of the blob, a name must not leave the root.
+func (s *LocalStore) location(name string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("blob name %q is not valid", name)
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(name)), nil
+}
+
+type localWriter struct {
+	file     *os.File
+	location string
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *localWriter) Close() error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(w.file.Name(), w.location); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return nil
+}
+
+func (w *localWriter) Abort(err error) {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// S3Store stores the blobs as objects of a bucket of an S3-compatible object storage, the name of a blob is the key of the object.
+type S3Store struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+var _ BlobStore = (*S3Store)(nil)
+
+// NewS3Store connects to the object storage and creates the bucket if it does not exist.
+func NewS3Store(ctx context.Context, cfg config.S3Storage) (*S3Store, error) {
+	return newS3Store(ctx, cfg, nil)
+}
+
+// newS3Store uses the transport to connect to the object storage, nil uses the default transport of the client.
+func newS3Store(ctx context.Context, cfg config.S3Storage, transport http.RoundTripper) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:    cfg.TLS,
+		Region:    cfg.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", cfg.Bucket, err)
+		}
+		slog.Info("Bucket created", "bucket", cfg.Bucket)
+	}
+
+	return &S3Store{client: client, bucket: cfg.Bucket, partSize: cfg.PartSizeMiB << 20}, nil
+}
+
+// Create streams the blob into the object storage, the object is stored with a multipart upload when the writer is closed.
+// The client buffers one part in memory, the part size also limits the size of the blob to 10000 parts.
+func (s *S3Store) Create(ctx context.Context, name string) (BlobWriter, error) {
+	reader, writer := io.Pipe()
+	result := make(chan error, 1)
+	go func() {
+		// the size is unknown, the client uploads parts while the blob is written
+		_, err := s.client.PutObject(ctx, s.bucket, name, reader, -1, minio.PutObjectOptions{PartSize: s.partSize})
+		reader.CloseWithError(err)
+		result <- err
+	}()
+
+	return &s3Writer{writer: writer, result: result, name: name}, nil
+}
+
+func (s *S3Store) Open(ctx context.Context, name string) (BlobReader, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError("open", name, err)
+	}
+	// GetObject is lazy, Stat fails if the object does not exist
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s.wrapError("open", name, err)
+	}
+
+	return object, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil {
+		return s.wrapError("delete", name, err)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, name string) (BlobInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return BlobInfo{}, s.wrapError("stat", name, err)
+	}
+
+	return BlobInfo{Name: name, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list blobs %s: %w", prefix, object.Err)
+		}
+		blobs = append(blobs, BlobInfo{Name: object.Key, Size: object.Size, ModTime: object.LastModified})
+	}
+
+	return blobs, nil
+}
+
+func (s *S3Store) HealthCheck(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+
+	return nil
+}
+
+func (s *S3Store) wrapError(operation string, name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return fmt.Errorf("failed to %s blob %s: %w", operation, name, err)
+}
+
+type s3Writer struct {
+	writer *io.PipeWriter
+	result chan error
+	name   string
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	w.writer.Close()
+	if err := <-w.result; err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", w.name, err)
+	}
+
+	return nil
+}
+
+// Abort fails the upload, the object storage discards the parts uploaded so far.
+func (w *s3Writer) Abort(err error) {
+	w.writer.CloseWithError(fmt.Errorf("blob aborted: %w", err))
+	<-w.result
+}
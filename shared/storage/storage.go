@@ -0,0 +1,61 @@
+// Package storage stores the bytes of the files, so that producer and cleaner do not have to share a local disk.
+//
+// The services receive the BlobStore from main like the MongoDB connection, main selects the backend from the configuration.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// ErrNotFound is returned if the blob does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs by name, names are separated by slashes like '<fileId>/<fileId>'.
+type BlobStore interface {
+	// Create writes a blob or replaces an existing one. The blob is only visible after Close succeeded.
+	Create(ctx context.Context, name string) (BlobWriter, error)
+	Open(ctx context.Context, name string) (BlobReader, error)
+	// Delete removes the blob, deleting a blob that does not exist succeeds.
+	Delete(ctx context.Context, name string) error
+	Stat(ctx context.Context, name string) (BlobInfo, error)
+	// List returns the blobs whose name starts with prefix, ordered by name.
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+	// HealthCheck returns an error if the blobs can not be accessed.
+	HealthCheck(ctx context.Context) error
+}
+
+// BlobWriter writes a blob. Close stores the bytes written so far, Abort discards them.
+type BlobWriter interface {
+	io.Writer
+	Close() error
+	Abort(err error)
+}
+
+// BlobReader reads a blob, it can seek to serve ranges of the blob.
+type BlobReader interface {
+	io.ReadSeekCloser
+}
+
+type BlobInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// New creates the BlobStore of the configured backend.
+func New(ctx context.Context, cfg config.Storage) (BlobStore, error) {
+	switch cfg.Backend {
+	case config.StorageBackendLocal:
+		return NewLocalStore(cfg.Path), nil
+	case config.StorageBackendS3:
+		return NewS3Store(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage backend %q is not supported", cfg.Backend)
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// testPartSizeMiB is the smallest part size S3 accepts, so that a small blob is already uploaded in several parts
+const testPartSizeMiB = 5
+
+// The contract tests run against each backend, producer and cleaner must not notice which one is configured.
+func TestBlobStore(t *testing.T) {
+	backends := map[string]func(t *testing.T) BlobStore{
+		"local": newTestLocalStore,
+		"s3":    newTestS3Store,
+	}
+
+	for backend, newStore := range backends {
+		t.Run(backend, func(t *testing.T) {
+			t.Run("stored blob can be read", func(t *testing.T) {
+				testStoredBlobCanBeRead(t, newStore(t))
+			})
+			t.Run("blob is invisible until closed", func(t *testing.T) {
+				testBlobIsInvisibleUntilClosed(t, newStore(t))
+			})
+			t.Run("aborted blob is discarded", func(t *testing.T) {
+				testAbortedBlobIsDiscarded(t, newStore(t))
+			})
+			t.Run("create replaces blob", func(t *testing.T) {
+				testCreateReplacesBlob(t, newStore(t))
+			})
+			t.Run("blob larger than a part", func(t *testing.T) {
+				testBlobLargerThanAPart(t, newStore(t))
+			})
+			t.Run("reader seeks", func(t *testing.T) {
+				testReaderSeeks(t, newStore(t))
+			})
+			t.Run("missing blob is not found", func(t *testing.T) {
+				testMissingBlobIsNotFound(t, newStore(t))
+			})
+			t.Run("delete", func(t *testing.T) {
+				testDelete(t, newStore(t))
+			})
+			t.Run("list by prefix", func(t *testing.T) {
+				testListByPrefix(t, newStore(t))
+			})
+			t.Run("health check", func(t *testing.T) {
+				if err := newStore(t).HealthCheck(context.Background()); err != nil {
+					t.Fatalf("HealthCheck failed: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func newTestLocalStore(t *testing.T) BlobStore {
+	return NewLocalStore(t.TempDir())
+}
+
+// newTestS3Store runs an in-memory S3 server, the client talks to it over HTTPS like to MinIO.
+// Without TLS the client signs each chunk of an upload, which the in-memory server does not decode.
+func newTestS3Store(t *testing.T) BlobStore {
+	server := httptest.NewTLSServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(server.Close)
+
+	store, err := newS3Store(context.Background(), config.S3Storage{
+		Endpoint:    strings.TrimPrefix(server.URL, "https://"),
+		Bucket:      "files",
+		Region:      "us-east-1",
+		AccessKey:   "test",
+		SecretKey:   "test",
+		TLS:         true,
+		PartSizeMiB: testPartSizeMiB,
+	}, server.Client().Transport)
+	if err != nil {
+		t.Fatalf("NewS3Store failed: %v", err)
+	}
+
+	return store
+}
+
+func testStoredBlobCanBeRead(t *testing.T, store BlobStore) {
+	content := []byte("file content")
+	writeBlob(t, store, "a/a", content)
+
+	if got := readBlob(t, store, "a/a"); !bytes.Equal(got, content) {
+		t.Fatalf("read %q, want %q", got, content)
+	}
+	info, err := store.Stat(context.Background(), "a/a")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Name != "a/a" || info.Size != int64(len(content)) {
+		t.Fatalf("Stat returned %s with %d bytes, want a/a with %d bytes", info.Name, info.Size, len(content))
+	}
+}
+
+func testBlobIsInvisibleUntilClosed(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	writer, err := store.Create(ctx, "a/a")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	writeInBackground(writer, []byte("partial"))
+
+	if _, err := store.Stat(ctx, "a/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of an open blob returned %v, want ErrNotFound", err)
+	}
+	if _, err := store.Open(ctx, "a/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open of an open blob returned %v, want ErrNotFound", err)
+	}
+
+	writer.Abort(errors.New("test finished"))
+}
+
+func testAbortedBlobIsDiscarded(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	writer, err := store.Create(ctx, "a/a")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	writeInBackground(writer, []byte("partial"))
+	writer.Abort(errors.New("upload cancelled"))
+
+	if _, err := store.Stat(ctx, "a/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of an aborted blob returned %v, want ErrNotFound", err)
+	}
+	blobs, err := store.List(ctx, "a/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(blobs) != 0 {
+		t.Fatalf("List returned %v after the abort, want no blobs", blobs)
+	}
+}
+
+func testCreateReplacesBlob(t *testing.T, store BlobStore) {
+	writeBlob(t, store, "a/a", []byte("first version"))
+	writeBlob(t, store, "a/a", []byte("second"))
+
+	if got := readBlob(t, store, "a/a"); string(got) != "second" {
+		t.Fatalf("read %q, want %q", got, "second")
+	}
+}
+
+func testBlobLargerThanAPart(t *testing.T, store BlobStore) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*testPartSizeMiB<<20+1024)/16)
+	writeBlob(t, store, "a/a", content)
+
+	if got := readBlob(t, store, "a/a"); !bytes.Equal(got, content) {
+		t.Fatalf("read %d bytes that differ from the %d bytes written", len(got), len(content))
+	}
+}
+
+func testReaderSeeks(t *testing.T, store BlobStore) {
+	writeBlob(t, store, "a/a", []byte("0123456789"))
+
+	reader, err := store.Open(context.Background(), "a/a")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(got) != "6789" {
+		t.Fatalf("read %q after seeking, want %q", got, "6789")
+	}
+}
+
+func testMissingBlobIsNotFound(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	if _, err := store.Open(ctx, "a/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open returned %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat(ctx, "a/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat returned %v, want ErrNotFound", err)
+	}
+}
+
+func testDelete(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	writeBlob(t, store, "a/a", []byte("content"))
+
+	if err := store.Delete(ctx, "a/a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Stat(ctx, "a/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of a deleted blob returned %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "a/a"); err != nil {
+		t.Fatalf("Delete of a missing blob failed: %v", err)
+	}
+}
+
+func testListByPrefix(t *testing.T, store BlobStore) {
+	for _, name := range []string{"b/b", "a/a", "a/c", "ab/ab"} {
+		writeBlob(t, store, name, []byte(name))
+	}
+
+	blobs, err := store.List(context.Background(), "a/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, blob := range blobs {
+		names = append(names, blob.Name)
+		if blob.Size != int64(len(blob.Name)) {
+			t.Errorf("List returned %s with %d bytes, want %d", blob.Name, blob.Size, len(blob.Name))
+		}
+	}
+	if strings.Join(names, ",") != "a/a,a/c" {
+		t.Fatalf("List returned %v, want [a/a a/c]", names)
+	}
+}
+
+func writeBlob(t *testing.T, store BlobStore, name string, content []byte) {
+	t.Helper()
+
+	writer, err := store.Create(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Create of %s failed: %v", name, err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatalf("Write of %s failed: %v", name, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close of %s failed: %v", name, err)
+	}
+}
+
+// writeInBackground writes without waiting, the S3 backend blocks a write until the upload reads it.
+func writeInBackground(writer BlobWriter, content []byte) {
+	go writer.Write(content)
+}
+
+func readBlob(t *testing.T, store BlobStore, name string) []byte {
+	t.Helper()
+
+	reader, err := store.Open(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Open of %s failed: %v", name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Read of %s failed: %v", name, err)
+	}
+
+	return content
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// DocumentField is the field of the file document that holds the trace context of the producer.
+const DocumentField = "TraceContext"
+
+// InjectDocument returns the trace context of ctx to be stored in DocumentField.
+func InjectDocument(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractDocument continues the trace context stored in DocumentField of the document, if there is one.
+func ExtractDocument(ctx context.Context, document bson.M) context.Context {
+	stored, ok := document[DocumentField].(bson.M)
+	if !ok {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{}
+	for key, value := range stored {
+		if value, ok := value.(string); ok {
+			carrier[key] = value
+		}
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// InjectMessage adds the trace context of ctx to the record headers.
+func InjectMessage(ctx context.Context, message *sarama.ProducerMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, producerMessageCarrier{message: message})
+}
+
+// ExtractMessage continues the trace context of the record headers.
+func ExtractMessage(ctx context.Context, message *sarama.ConsumerMessage) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, consumerMessageCarrier{message: message})
+}
+
+type producerMessageCarrier struct {
+	message *sarama.ProducerMessage
+}
+
+func (c producerMessageCarrier) Get(key string) string {
+	for _, header := range c.message.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// Set replaces the header, a message that is published again must not carry two trace contexts.
+func (c producerMessageCarrier) Set(key string, value string) {
+	for i, header := range c.message.Headers {
+		if string(header.Key) == key {
+			c.message.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+
+	c.message.Headers = append(c.message.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.message.Headers))
+	for _, header := range c.message.Headers {
+		keys = append(keys, string(header.Key))
+	}
+
+	return keys
+}
+
+type consumerMessageCarrier struct {
+	message *sarama.ConsumerMessage
+}
+
+func (c consumerMessageCarrier) Get(key string) string {
+	for _, header := range c.message.Headers {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// Set is not used, the trace context is only extracted from consumed messages.
+func (c consumerMessageCarrier) Set(key string, value string) {}
+
+func (c consumerMessageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.message.Headers))
+	for _, header := range c.message.Headers {
+		keys = append(keys, string(header.Key))
+	}
+
+	return keys
+}
@@ -0,0 +1,81 @@
+// Package tracing sets up OpenTelemetry and propagates the trace context of a file through MongoDB and Kafka.
+//
+// The producer stores the trace context in the document of the file, the miner continues it from the change event
+// and injects it into the record headers, the consumer continues it from the record headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/logging"
+)
+
+// Setup installs the W3C trace context propagator and the tracer provider of the configured exporter.
+// Without exporter the trace context is still propagated, so a service in the middle does not break the trace.
+// The returned function flushes the spans that were not exported yet, call it on shutdown.
+func Setup(ctx context.Context, service string, cfg config.Tracing) (func(), error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "none":
+		return func() {}, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("tracing exporter %q is not supported", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	provider := NewTracerProvider(service, exporter, cfg.SampleRatio)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		// the application context is usually cancelled at this point
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to flush traces", logging.Error(err))
+		}
+	}, nil
+}
+
+// NewTracerProvider exports the spans of the service in batches. Tests pass an in-memory exporter of the tracetest package
+// and call ForceFlush before they inspect the spans.
+func NewTracerProvider(service string, exporter sdktrace.SpanExporter, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+		// a continued trace keeps the decision of the service that started it
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+}
+
+// End records the error on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
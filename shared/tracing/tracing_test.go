@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"go.mongodb.org/mongo-driver/bson"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/KinNeko-De/sample-eventual-consistency-transaction-log-tailing-mongodb/shared/config"
+)
+
+// newTestTracerProvider installs the propagator of Setup and returns a provider that keeps the spans in memory.
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	if _, err := Setup(context.Background(), "test", config.Tracing{Exporter: "none"}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewTracerProvider("test", exporter, 1)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return provider, exporter
+}
+
+// The trace of a file starts at the upload in the producer, continues in the miner from the change event
+// and ends in the consumer that received the record.
+func TestTraceContextIsPropagatedFromDocumentToConsumer(t *testing.T) {
+	provider, exporter := newTestTracerProvider(t)
+	ctx := context.Background()
+
+	producerCtx, producerSpan := provider.Tracer("producer").Start(ctx, "store file")
+	// the change event contains the stored document, the trace context is decoded as embedded document
+	document := bson.M{"FileId": "a"}
+	storedContext := bson.M{}
+	for key, value := range InjectDocument(producerCtx) {
+		storedContext[key] = value
+	}
+	document[DocumentField] = storedContext
+	producerSpan.End()
+
+	minerCtx, minerSpan := provider.Tracer("miner").Start(ExtractDocument(ctx, document), "file-stored publish", trace.WithSpanKind(trace.SpanKindProducer))
+	published := &sarama.ProducerMessage{Topic: "file-stored"}
+	InjectMessage(minerCtx, published)
+	minerSpan.End()
+
+	consumed := &sarama.ConsumerMessage{Topic: published.Topic}
+	for _, header := range published.Headers {
+		consumed.Headers = append(consumed.Headers, &sarama.RecordHeader{Key: header.Key, Value: header.Value})
+	}
+	_, consumerSpan := provider.Tracer("consumer").Start(ExtractMessage(ctx, consumed), "file-stored process", trace.WithSpanKind(trace.SpanKindConsumer))
+	consumerSpan.End()
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush failed: %v", err)
+	}
+	spans := spansByName(exporter.GetSpans())
+	store, publish, process := spans["store file"], spans["file-stored publish"], spans["file-stored process"]
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(spans))
+	}
+	if publish.Parent.SpanID() != store.SpanContext.SpanID() || publish.SpanContext.TraceID() != store.SpanContext.TraceID() {
+		t.Errorf("publish span has parent %s in trace %s, want the store span", publish.Parent.SpanID(), publish.SpanContext.TraceID())
+	}
+	if process.Parent.SpanID() != publish.SpanContext.SpanID() || process.SpanContext.TraceID() != store.SpanContext.TraceID() {
+		t.Errorf("process span has parent %s in trace %s, want the publish span", process.Parent.SpanID(), process.SpanContext.TraceID())
+	}
+	if !process.Parent.IsRemote() {
+		t.Error("process span continues a local parent, want the remote publish span")
+	}
+}
+
+func TestExtractDocumentWithoutTraceContext(t *testing.T) {
+	newTestTracerProvider(t)
+
+	ctx := ExtractDocument(context.Background(), bson.M{"FileId": "a"})
+
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatal("ExtractDocument returned a span context for a document without trace context")
+	}
+}
+
+// A message that is published again, e.g. to a retry topic, keeps a single trace context.
+func TestInjectMessageReplacesTraceContext(t *testing.T) {
+	provider, _ := newTestTracerProvider(t)
+	message := &sarama.ProducerMessage{Topic: "file-stored"}
+
+	firstCtx, first := provider.Tracer("test").Start(context.Background(), "first")
+	InjectMessage(firstCtx, message)
+	first.End()
+	secondCtx, second := provider.Tracer("test").Start(context.Background(), "second")
+	InjectMessage(secondCtx, message)
+	second.End()
+
+	traceparents := 0
+	for _, header := range message.Headers {
+		if string(header.Key) == "traceparent" {
+			traceparents++
+		}
+	}
+	if traceparents != 1 {
+		t.Fatalf("message has %d traceparent headers, want 1", traceparents)
+	}
+	consumed := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{Key: message.Headers[0].Key, Value: message.Headers[0].Value}}}
+	if got := trace.SpanContextFromContext(ExtractMessage(context.Background(), consumed)); got.SpanID() != second.SpanContext().SpanID() {
+		t.Fatalf("extracted span %s, want the span of the second injection %s", got.SpanID(), second.SpanContext().SpanID())
+	}
+}
+
+func spansByName(spans tracetest.SpanStubs) map[string]tracetest.SpanStub {
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	return byName
+}